@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var loginEp = "/cloud/login/"
+
+type LoginResponse struct {
+	Response `yaml:",inline"`
+	Data     struct {
+		Token string `json:"token" yaml:"token"`
+	} `json:"data" yaml:"data"`
+}
+
+// Login exchanges a username and a password for a bearer token. The
+// credentials are sent in the request body, never in the url.
+func (c *ManagerClient) Login(ctx context.Context, username, password string) (*LoginResponse, error) {
+	form := url.Values{}
+	form.Add("username", username)
+	form.Add("password", password)
+
+	var response LoginResponse
+	err := c.do(ctx, http.MethodPost, loginEp, nil, strings.NewReader(form.Encode()),
+		"application/x-www-form-urlencoded", &response)
+	return &response, err
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+
+// Package client is a typed Go client for the cloud manager API used by the
+// cloud cli. Every method maps to a single manager endpoint and returns the
+// decoded response, or an *Error if the request failed or the manager
+// rejected it.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var initEp = "/cloud/"
+
+// ErrNoEndpoint is returned when the client has no manager to talk to.
+var ErrNoEndpoint = errors.New("no manager endpoint configured")
+
+// ManagerClient talks to a single cloud manager.
+type ManagerClient struct {
+	// Endpoint is the base url of the manager, e.g. https://10.140.17.117
+	Endpoint string
+	// HTTPClient is used to send every request, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Token is sent as a bearer token with every request, if set
+	Token string
+	// Retry is the retry policy, the zero value never retries
+	Retry RetryPolicy
+	// IdempotencyKeys sends an Idempotency-Key header with every request so
+	// that requests other than reads can be retried safely. Only enable it
+	// if the manager honors the header.
+	IdempotencyKeys bool
+}
+
+// Response holds the fields shared by every manager response.
+type Response struct {
+	Status bool   `json:"status" yaml:"status"`
+	Msg    string `json:"msg" yaml:"msg"`
+}
+
+func (r *Response) rejected() error {
+	if r.Status {
+		return nil
+	}
+	return &Error{Kind: KindRejected, Msg: r.Msg}
+}
+
+// result is implemented by every response type through the embedded Response.
+type result interface {
+	rejected() error
+}
+
+// New returns a ManagerClient for the manager at endpoint.
+func New(endpoint string, httpClient *http.Client) *ManagerClient {
+	return &ManagerClient{Endpoint: endpoint, HTTPClient: httpClient}
+}
+
+// Init initializes the cloud.
+func (c *ManagerClient) Init(ctx context.Context) (*Response, error) {
+	var response Response
+	err := c.do(ctx, http.MethodPost, initEp, nil, nil, "", &response)
+	return &response, err
+}
+
+// do sends a single request to the manager and decodes the response into out.
+func (c *ManagerClient) do(ctx context.Context, method, path string, params url.Values, body io.Reader, contentType string, out result) error {
+	res, err := c.request(ctx, method, path, params, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Read the response
+	data, err := io.ReadAll(res.Body)
+	if err != nil && ctx.Err() != nil {
+		return interrupted(ctx, method, true)
+	}
+	if err != nil {
+		return &Error{Kind: KindUnreachable, Err: err}
+	}
+
+	// Decode the response
+	if !isJSON(res) {
+		return &Error{
+			Kind: KindMalformed,
+			Err:  fmt.Errorf("expected JSON, got %s", res.Header.Get("Content-Type")),
+			Body: snippet(data),
+		}
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return &Error{Kind: KindMalformed, Err: err, Body: snippet(data)}
+	}
+	return out.rejected()
+}
+
+// request sends a single request to the manager and returns the response if
+// its status is 2xx. The caller must close the body.
+func (c *ManagerClient) request(ctx context.Context, method, path string, params url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	if c.Endpoint == "" {
+		closeBody(body)
+		return nil, &Error{Kind: KindUnknown, Err: ErrNoEndpoint}
+	}
+
+	// Build the request
+	req, err := http.NewRequestWithContext(ctx, method, c.Endpoint+path, body)
+	if err != nil {
+		closeBody(body)
+		return nil, &Error{Kind: KindUnknown, Err: err}
+	}
+	if params != nil {
+		req.URL.RawQuery = params.Encode()
+	}
+	if s, ok := body.(*stream); ok {
+		req.GetBody = s.open
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	// Send the request
+	res, sent, err := c.send(ctx, req)
+	if err != nil && ctx.Err() != nil {
+		return nil, interrupted(ctx, method, sent)
+	}
+	if isTLSError(err) {
+		return nil, &Error{Kind: KindTLS, Err: err}
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindUnreachable, Err: err, MayHaveApplied: sent && method != http.MethodGet}
+	}
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	// Read why it failed
+	data, err := io.ReadAll(res.Body)
+	if err != nil && ctx.Err() != nil {
+		return nil, interrupted(ctx, method, true)
+	}
+	if err != nil {
+		return nil, &Error{Kind: KindUnreachable, Err: err}
+	}
+	return nil, statusError(req, res, data)
+}
+
+// closeBody closes body if it is an io.Closer. The transport closes the body
+// of the requests it sends, those given up before must be closed by hand.
+func closeBody(body io.Reader) {
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// stream is a request body that is produced again for every attempt to send
+// the request, e.g. a file upload.
+type stream struct {
+	io.ReadCloser
+	open func() (io.ReadCloser, error)
+}
+
+// statusError maps an answer outside of 2xx to an error. The manager's
+// message is kept when the body is one of its usual responses.
+func statusError(req *http.Request, res *http.Response, data []byte) error {
+	e := &Error{
+		Kind:       KindStatus,
+		StatusCode: res.StatusCode,
+		URL:        req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+	}
+
+	var response Response
+	if isJSON(res) && json.Unmarshal(data, &response) == nil && response.Msg != "" {
+		e.Msg = response.Msg
+	} else {
+		e.Body = snippet(data)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		e.Kind = KindUnauthorized
+	case res.StatusCode == http.StatusForbidden:
+		e.Kind = KindForbidden
+	case res.StatusCode == http.StatusNotFound:
+		e.Kind = KindNotFound
+	case res.StatusCode == http.StatusConflict:
+		e.Kind = KindConflict
+	case res.StatusCode >= 500:
+		e.Kind = KindServer
+	}
+	return e
+}
+
+// isJSON reports whether res may hold JSON. A missing Content-Type is given
+// the benefit of the doubt.
+func isJSON(res *http.Response) bool {
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// snippet returns the beginning of a body on a single line, to be shown in
+// an error.
+func snippet(data []byte) string {
+	const length = 200
+
+	text := strings.Join(strings.Fields(string(data)), " ")
+	if utf8.RuneCountInString(text) > length {
+		text = string([]rune(text)[:length]) + "..."
+	}
+	return text
+}
+
+// interrupted builds the error of a request stopped by its context. Only a
+// request that reached the manager and is not a read may have been applied.
+func interrupted(ctx context.Context, method string, sent bool) error {
+	kind := KindCanceled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		kind = KindTimeout
+	}
+	return &Error{
+		Kind:           kind,
+		Err:            ctx.Err(),
+		MayHaveApplied: sent && method != http.MethodGet,
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var elasticityEp = "/cloud/elasticity/"
+
+// SetLowerThreshold sets the lower elastic threshold for a given pod.
+func (c *ManagerClient) SetLowerThreshold(ctx context.Context, podId string, value float64) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+	params.Add("lower_threshold", strconv.FormatFloat(value, 'f', -1, 64))
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, elasticityEp+"lower/", params, nil, "", &response)
+	return &response, err
+}
+
+// SetUpperThreshold sets the upper elastic threshold for a given pod.
+func (c *ManagerClient) SetUpperThreshold(ctx context.Context, podId string, value float64) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+	params.Add("upper_threshold", strconv.FormatFloat(value, 'f', -1, 64))
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, elasticityEp+"upper/", params, nil, "", &response)
+	return &response, err
+}
+
+// EnableElasticity enables elasticity for a given pod with the min and max
+// amount of nodes in elastic mode.
+func (c *ManagerClient) EnableElasticity(ctx context.Context, podId string, minNode, maxNode int) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+	params.Add("min_node", strconv.Itoa(minNode))
+	params.Add("max_node", strconv.Itoa(maxNode))
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, elasticityEp+"enable/", params, nil, "", &response)
+	return &response, err
+}
+
+// DisableElasticity disables elasticity for a given pod.
+func (c *ManagerClient) DisableElasticity(ctx context.Context, podId string) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, elasticityEp+"disable/", params, nil, "", &response)
+	return &response, err
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind categorizes the errors returned by a ManagerClient.
+type Kind int
+
+const (
+	// KindUnknown is any error that does not fit another kind.
+	KindUnknown Kind = iota
+	// KindUnreachable means the request never got an answer from the manager.
+	KindUnreachable
+	// KindRejected means the manager answered with status=false.
+	KindRejected
+	// KindMalformed means the manager answered with something we could not
+	// decode.
+	KindMalformed
+	// KindTLS means the manager's certificate could not be verified.
+	KindTLS
+	// KindUnauthorized means the manager refused our credentials.
+	KindUnauthorized
+	// KindTimeout means the manager did not answer before the deadline of
+	// the context.
+	KindTimeout
+	// KindCanceled means the context was canceled before the manager
+	// answered.
+	KindCanceled
+	// KindForbidden means the manager answered 403, our credentials do not
+	// allow the request.
+	KindForbidden
+	// KindNotFound means the manager answered 404, usually a wrong manager
+	// url.
+	KindNotFound
+	// KindConflict means the manager answered 409.
+	KindConflict
+	// KindServer means the manager, or a proxy in front of it, answered
+	// with a 5xx status.
+	KindServer
+	// KindStatus is any other status outside of 2xx.
+	KindStatus
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindUnreachable:
+		return "unreachable"
+	case KindRejected:
+		return "rejected"
+	case KindMalformed:
+		return "malformed"
+	case KindTLS:
+		return "tls"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindTimeout:
+		return "timeout"
+	case KindCanceled:
+		return "canceled"
+	case KindForbidden:
+		return "forbidden"
+	case KindNotFound:
+		return "not found"
+	case KindConflict:
+		return "conflict"
+	case KindServer:
+		return "server"
+	case KindStatus:
+		return "status"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is the error returned by every ManagerClient method.
+type Error struct {
+	Kind Kind
+	// Msg is the message sent by the manager, if any
+	Msg string
+	// Err is the underlying error, if any
+	Err error
+	// StatusCode is the http status of the answer, if any
+	StatusCode int
+	// URL is the url the request was sent to
+	URL string
+	// Body is the beginning of the answer when it is an error or could not
+	// be decoded
+	Body string
+	// MayHaveApplied is set on timeouts, cancellations and lost connections
+	// when the request was fully sent and could change the state of the
+	// manager
+	MayHaveApplied bool
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case KindUnreachable:
+		return fmt.Sprintf("manager unreachable: %v", e.Err)
+	case KindRejected:
+		if e.Msg == "" {
+			return "rejected by the manager"
+		}
+		return fmt.Sprintf("rejected by the manager: %s", e.Msg)
+	case KindMalformed:
+		return withDetail(fmt.Sprintf("malformed response from the manager: %v", e.Err), e.Body)
+	case KindTLS:
+		return fmt.Sprintf("could not verify the manager's certificate: %v", e.Err)
+	case KindUnauthorized:
+		return "unauthorized: not logged in or the token expired"
+	case KindTimeout:
+		return "timed out waiting for the manager"
+	case KindCanceled:
+		return "interrupted before the manager answered"
+	case KindForbidden:
+		return withDetail("forbidden: the current credentials do not allow this request", e.detail())
+	case KindNotFound:
+		if e.URL == "" {
+			return withDetail("not found", e.detail())
+		}
+		return withDetail(fmt.Sprintf("not found (HTTP 404) at %s, check the manager url", e.URL), e.detail())
+	case KindConflict:
+		return withDetail("conflict (HTTP 409)", e.detail())
+	case KindServer:
+		return withDetail(fmt.Sprintf("manager error (HTTP %d)", e.StatusCode), e.detail())
+	case KindStatus:
+		return withDetail(fmt.Sprintf("unexpected HTTP status %d", e.StatusCode), e.detail())
+	default:
+		if e.Err == nil {
+			return withDetail(e.Kind.String()+" error", e.detail())
+		}
+		return e.Err.Error()
+	}
+}
+
+// detail is the manager's message if it sent one, the body otherwise.
+func (e *Error) detail() string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return e.Body
+}
+
+func withDetail(msg, detail string) string {
+	if detail == "" {
+		return msg
+	}
+	return msg + ": " + detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of err, KindUnknown if err is not an *Error.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindUnknown
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var jobEp = "/cloud/job/"
+
+// Job is a job as reported by the manager.
+type Job struct {
+	Name   string `json:"name" yaml:"name"`
+	Id     string `json:"id" yaml:"id"`
+	Status string `json:"status" yaml:"status"`
+	Node   string `json:"node" yaml:"node"`
+	// Spec is what the job was launched with, if the manager reports it
+	Spec *JobSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+}
+
+// JobSpec is how a job is run, sent along with its script. Zero values are
+// left to the manager.
+type JobSpec struct {
+	// Env holds the environment variables of the script
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Args are passed to the script
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+	// CPU is the number of cores the job needs, e.g. 0.5
+	CPU float64 `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	// Memory is the memory the job needs, in bytes
+	Memory int64 `json:"memory,omitempty" yaml:"memory,omitempty"`
+	// Timeout is how long the job may run, in seconds
+	Timeout int64 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+type JobListResponse struct {
+	Response `yaml:",inline"`
+	Data     []Job `json:"data" yaml:"data"`
+}
+
+type JobLaunchResponse struct {
+	Response `yaml:",inline"`
+	Data     struct {
+		Id string `json:"job_id" yaml:"job_id"`
+	} `json:"data" yaml:"data"`
+}
+
+// ListJobs lists all jobs on a specific node. If nodeId is empty, all jobs
+// are listed.
+func (c *ManagerClient) ListJobs(ctx context.Context, nodeId string) (*JobListResponse, error) {
+	params := url.Values{}
+	if nodeId != "" {
+		params.Add("node_id", nodeId)
+	}
+
+	var response JobListResponse
+	err := c.do(ctx, http.MethodGet, jobEp, params, nil, "", &response)
+	return &response, err
+}
+
+// LaunchJob launches a job given a job name and a job script. filename is
+// the name the script is uploaded under. The upload is retried only if
+// script is an io.ReaderAt, e.g. an *os.File, so that it can be sent again.
+func (c *ManagerClient) LaunchJob(ctx context.Context, jobName, filename string, script io.Reader) (*JobLaunchResponse, error) {
+	return c.LaunchJobUpload(ctx, jobName, &JobUpload{Filename: filename, OpenScript: rewind(script)})
+}
+
+// ErrNoScript is returned when a job is launched with neither a script nor a
+// bundle to upload.
+var ErrNoScript = errors.New("no script or bundle to upload")
+
+// JobUpload holds the files uploaded to launch a job. They are opened again
+// for every attempt to send them.
+type JobUpload struct {
+	// Filename is the name the script is uploaded under
+	Filename string
+	// OpenScript opens the script run by the job, unless there is a bundle
+	OpenScript func() (io.ReadCloser, error)
+	// OpenBundle, if set, opens a gzipped tar archive of the files of the
+	// job, uploaded instead of the script
+	OpenBundle func() (io.ReadCloser, error)
+	// Entrypoint is the path of the script within the bundle
+	Entrypoint string
+	// Spec, if set, is sent as the job_spec field
+	Spec *JobSpec
+}
+
+// LaunchJobUpload launches a job given a job name and the files to upload.
+// The files are streamed to the manager rather than read in memory first.
+func (c *ManagerClient) LaunchJobUpload(ctx context.Context, jobName string, upload *JobUpload) (*JobLaunchResponse, error) {
+	// Prepare the files
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	open := func() (io.ReadCloser, error) {
+		// The bundle holds the script
+		openFile := upload.OpenScript
+		if upload.OpenBundle != nil {
+			openFile = upload.OpenBundle
+		}
+		file, err := openFile()
+		if err != nil {
+			return nil, err
+		}
+
+		reader, writer := io.Pipe()
+		go func() {
+			err := writeUpload(writer, boundary, upload, file)
+			writer.CloseWithError(err)
+		}()
+		return reader, nil
+	}
+	if c.Endpoint == "" {
+		return nil, &Error{Kind: KindUnknown, Err: ErrNoEndpoint}
+	}
+	if upload.OpenScript == nil && upload.OpenBundle == nil {
+		return nil, &Error{Kind: KindUnknown, Err: ErrNoScript}
+	}
+	body, err := open()
+	if err != nil {
+		return nil, &Error{Kind: KindUnknown, Err: err}
+	}
+
+	params := url.Values{}
+	params.Add("job_name", jobName)
+	if upload.OpenBundle != nil {
+		params.Add("entrypoint", upload.Entrypoint)
+	}
+
+	var response JobLaunchResponse
+	err = c.do(ctx, http.MethodPost, jobEp, params, &stream{ReadCloser: body, open: open}, "multipart/form-data; boundary="+boundary, &response)
+	return &response, err
+}
+
+// writeUpload writes the multipart form of an upload to w, with file as the
+// script or the bundle, and closes file.
+func writeUpload(w io.Writer, boundary string, upload *JobUpload, file io.ReadCloser) error {
+	defer file.Close()
+
+	writer := multipart.NewWriter(w)
+	err := writer.SetBoundary(boundary)
+	if err != nil {
+		return err
+	}
+
+	if upload.Spec != nil {
+		spec, err := json.Marshal(upload.Spec)
+		if err != nil {
+			return err
+		}
+		err = writer.WriteField("job_spec", string(spec))
+		if err != nil {
+			return err
+		}
+	}
+
+	field, filename := "job_script", upload.Filename
+	if upload.OpenBundle != nil {
+		field, filename = "job_bundle", "bundle.tar.gz"
+	}
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// rewind returns an open function for JobUpload that reads r from its start
+// if r is an io.ReaderAt, without sharing an offset with a previous attempt
+// still being torn down. Otherwise r can only be opened once.
+func rewind(r io.Reader) func() (io.ReadCloser, error) {
+	opened := false
+	return func() (io.ReadCloser, error) {
+		if at, ok := r.(io.ReaderAt); ok {
+			return io.NopCloser(io.NewSectionReader(at, 0, math.MaxInt64)), nil
+		}
+		if opened {
+			return nil, errors.New("the script cannot be read again")
+		}
+		opened = true
+		return io.NopCloser(r), nil
+	}
+}
+
+// AbortJob aborts a job given that job's id.
+func (c *ManagerClient) AbortJob(ctx context.Context, jobId string) (*Response, error) {
+	params := url.Values{}
+	params.Add("job_id", jobId)
+
+	var response Response
+	err := c.do(ctx, http.MethodDelete, jobEp, params, nil, "", &response)
+	return &response, err
+}
+
+// JobLog fetches the log of a specific job.
+func (c *ManagerClient) JobLog(ctx context.Context, jobId string) (*LogResponse, error) {
+	params := url.Values{}
+	params.Add("job_id", jobId)
+
+	var response LogResponse
+	err := c.do(ctx, http.MethodGet, jobEp+"log/", params, nil, "", &response)
+	return &response, err
+}
+
+// JobDetails is what the manager knows of a job. Managers may leave out any
+// field but those of Job.
+type JobDetails struct {
+	Job `yaml:",inline"`
+	// Pod is the name of the pod of the job's node
+	Pod       string     `json:"pod,omitempty" yaml:"pod,omitempty"`
+	Submitted *time.Time `json:"submitted,omitempty" yaml:"submitted,omitempty"`
+	Started   *time.Time `json:"started,omitempty" yaml:"started,omitempty"`
+	Ended     *time.Time `json:"ended,omitempty" yaml:"ended,omitempty"`
+	// ExitCode is the exit code of the script, nil if it did not exit
+	ExitCode *int   `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+	Filename string `json:"filename,omitempty" yaml:"filename,omitempty"`
+	// Sha256 is the hex encoded SHA-256 of the script
+	Sha256  string          `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	History []JobTransition `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+// JobTransition is a change of status of a job.
+type JobTransition struct {
+	Status string    `json:"status" yaml:"status"`
+	Time   time.Time `json:"time" yaml:"time"`
+}
+
+type JobDescribeResponse struct {
+	Response `yaml:",inline"`
+	Data     JobDetails `json:"data" yaml:"data"`
+}
+
+// DescribeJob fetches the details of a specific job. Managers without the
+// endpoint answer with a KindNotFound error.
+func (c *ManagerClient) DescribeJob(ctx context.Context, jobId string) (*JobDescribeResponse, error) {
+	params := url.Values{}
+	params.Add("job_id", jobId)
+
+	var response JobDescribeResponse
+	err := c.do(ctx, http.MethodGet, jobEp+"describe/", params, nil, "", &response)
+	return &response, err
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+var nodeEp = "/cloud/node/"
+
+// Node is a job or server node as reported by the manager.
+type Node struct {
+	Name   string  `json:"node_name" yaml:"node_name"`
+	Id     string  `json:"node_id" yaml:"node_id"`
+	Type   string  `json:"node_type" yaml:"node_type"`
+	Status string  `json:"node_status" yaml:"node_status"`
+	Pod    NodePod `json:"pod_data" yaml:"pod_data"`
+}
+
+// NodePod identifies the pod a node belongs to.
+type NodePod struct {
+	Name string `json:"pod_name" yaml:"pod_name"`
+	Id   string `json:"pod_id" yaml:"pod_id"`
+}
+
+type NodeListResponse struct {
+	Response `yaml:",inline"`
+	Data     []Node `json:"data" yaml:"data"`
+}
+
+// LogResponse carries the log of a node or a job.
+type LogResponse struct {
+	Response `yaml:",inline"`
+	Data     string `json:"data" yaml:"data"`
+}
+
+// ListNodes lists all nodes in a specific pod. If podId is empty, all nodes
+// are listed.
+func (c *ManagerClient) ListNodes(ctx context.Context, podId string) (*NodeListResponse, error) {
+	params := url.Values{}
+	if podId != "" {
+		params.Add("pod_id", podId)
+	}
+
+	var response NodeListResponse
+	err := c.do(ctx, http.MethodGet, nodeEp, params, nil, "", &response)
+	return &response, err
+}
+
+// RegisterNode registers a node with a given type, name and a target pod id.
+// The type can either be "job" or "server".
+func (c *ManagerClient) RegisterNode(ctx context.Context, nodeType, nodeName, podId string) (*Response, error) {
+	params := url.Values{}
+	params.Add("node_type", nodeType)
+	params.Add("node_name", nodeName)
+	params.Add("pod_id", podId)
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, nodeEp, params, nil, "", &response)
+	return &response, err
+}
+
+// RemoveNode removes a specific node given its id.
+func (c *ManagerClient) RemoveNode(ctx context.Context, nodeId string) (*Response, error) {
+	params := url.Values{}
+	params.Add("node_id", nodeId)
+
+	var response Response
+	err := c.do(ctx, http.MethodDelete, nodeEp, params, nil, "", &response)
+	return &response, err
+}
+
+// NodeLog fetches the log of a specific node.
+func (c *ManagerClient) NodeLog(ctx context.Context, nodeId string) (*LogResponse, error) {
+	params := url.Values{}
+	params.Add("node_id", nodeId)
+
+	var response LogResponse
+	err := c.do(ctx, http.MethodGet, nodeEp+"log/", params, nil, "", &response)
+	return &response, err
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var outputEp = "/cloud/job/output/"
+
+// Artifact is a file produced by a job.
+type Artifact struct {
+	// Name is the path of the file relative to the job's output directory
+	Name string `json:"name" yaml:"name"`
+	Size int64  `json:"size" yaml:"size"`
+	// Sha256 is the hex encoded SHA-256 of the file, empty if unknown
+	Sha256 string `json:"sha256" yaml:"sha256"`
+}
+
+type ArtifactListResponse struct {
+	Response `yaml:",inline"`
+	Data     []Artifact `json:"data" yaml:"data"`
+}
+
+// ListArtifacts lists the files produced by a job.
+func (c *ManagerClient) ListArtifacts(ctx context.Context, jobId string) (*ArtifactListResponse, error) {
+	params := url.Values{}
+	params.Add("job_id", jobId)
+
+	var response ArtifactListResponse
+	err := c.do(ctx, http.MethodGet, outputEp, params, nil, "", &response)
+	return &response, err
+}
+
+// DownloadArtifact opens the content of a file produced by a job. The caller
+// must close it. Reading it may fail with an *Error once ctx is done.
+func (c *ManagerClient) DownloadArtifact(ctx context.Context, jobId, name string) (io.ReadCloser, error) {
+	params := url.Values{}
+	params.Add("job_id", jobId)
+	params.Add("name", name)
+
+	res, err := c.request(ctx, http.MethodGet, outputEp+"file/", params, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &download{ctx: ctx, body: res.Body}, nil
+}
+
+// download is the body of an artifact, its read errors are mapped to *Error
+// like those of the other requests.
+type download struct {
+	ctx  context.Context
+	body io.ReadCloser
+}
+
+func (d *download) Read(p []byte) (int, error) {
+	n, err := d.body.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	if d.ctx.Err() != nil {
+		return n, interrupted(d.ctx, http.MethodGet, true)
+	}
+	return n, &Error{Kind: KindUnreachable, Err: err}
+}
+
+func (d *download) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+var podEp = "/cloud/pod/"
+
+// Pod is a resource pod as reported by the manager.
+type Pod struct {
+	Name    string  `json:"pod_name" yaml:"pod_name"`
+	Id      string  `json:"pod_id" yaml:"pod_id"`
+	Type    string  `json:"pod_type" yaml:"pod_type"`
+	Elastic bool    `json:"is_elastic" yaml:"is_elastic"`
+	Usage   float32 `json:"usage" yaml:"usage"`
+	Nodes   int     `json:"total_nodes" yaml:"total_nodes"`
+}
+
+type PodListResponse struct {
+	Response `yaml:",inline"`
+	Data     []Pod `json:"data" yaml:"data"`
+}
+
+// ListPods lists all pods.
+func (c *ManagerClient) ListPods(ctx context.Context) (*PodListResponse, error) {
+	var response PodListResponse
+	err := c.do(ctx, http.MethodGet, podEp, nil, nil, "", &response)
+	return &response, err
+}
+
+// RegisterPod registers a new pod given a pod type and a name.
+func (c *ManagerClient) RegisterPod(ctx context.Context, podType, podName string) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_type", podType)
+	params.Add("pod_name", podName)
+
+	var response Response
+	err := c.do(ctx, http.MethodPost, podEp, params, nil, "", &response)
+	return &response, err
+}
+
+// RemovePod removes a specific pod given its id.
+func (c *ManagerClient) RemovePod(ctx context.Context, podId string) (*Response, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+
+	var response Response
+	err := c.do(ctx, http.MethodDelete, podEp, params, nil, "", &response)
+	return &response, err
+}
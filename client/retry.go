@@ -0,0 +1,172 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Reads are retried
+// when the manager cannot be reached or answers with a transient status.
+// Other requests are only retried when the connection was refused, since the
+// manager then never saw them, unless the client sends idempotency keys.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 1 or less disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, except when the manager
+	// asks for a longer one with Retry-After
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is a sensible policy for interactive use.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// backoff returns the delay before the given retry, with jitter so that many
+// clients do not retry in lockstep.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(mathrand.Int63n(int64(half)+1))
+}
+
+// send sends req, retrying it according to c.Retry. It reports whether any
+// attempt was fully written to the manager.
+func (c *ManagerClient) send(ctx context.Context, req *http.Request) (*http.Response, bool, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	idempotent := req.Method == http.MethodGet
+	if !idempotent && c.IdempotencyKeys {
+		req.Header.Set("Idempotency-Key", newIdempotencyKey())
+		idempotent = true
+	}
+
+	var sent bool
+	for attempt := 1; ; attempt++ {
+		// Keep track of whether the manager got the whole request, in case
+		// it gets interrupted
+		var wrote atomic.Bool
+		trace := &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err == nil {
+					wrote.Store(true)
+				}
+			},
+		}
+		attemptReq := req.Clone(httptrace.WithClientTrace(ctx, trace))
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, sent, err
+			}
+			attemptReq.Body = body
+		}
+
+		res, err := httpClient.Do(attemptReq)
+		sent = sent || wrote.Load()
+		if attempt >= c.Retry.MaxAttempts || ctx.Err() != nil {
+			return res, sent, err
+		}
+
+		// A body that cannot be sent again rules out any retry
+		if req.Body != nil && req.GetBody == nil {
+			return res, sent, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil && errors.Is(err, syscall.ECONNREFUSED):
+			delay = c.Retry.backoff(attempt)
+		case err != nil && idempotent && !isTLSError(err):
+			delay = c.Retry.backoff(attempt)
+		case err == nil && idempotent && transientStatus(res.StatusCode):
+			delay = retryAfter(res)
+			if delay < 0 {
+				delay = c.Retry.backoff(attempt)
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		default:
+			return res, sent, err
+		}
+
+		// Wait before the next attempt, unless the context is done first
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, sent, ctx.Err()
+		}
+	}
+}
+
+// transientStatus reports whether a request answered with status may
+// succeed if sent again.
+func transientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of res,
+// or -1 if there is none.
+func retryAfter(res *http.Response) time.Duration {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return -1
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay
+	}
+	return -1
+}
+
+// newIdempotencyKey returns a random key identifying a single logical request
+// across its attempts.
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(key)
+}
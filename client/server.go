@@ -0,0 +1,47 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+var serverEp = "/cloud/server/"
+
+// ServerNode is a server node and the port it is reachable on.
+type ServerNode struct {
+	NodeId string `json:"node_id" yaml:"node_id"`
+	Port   int    `json:"port" yaml:"port"`
+}
+
+type ServerResponse struct {
+	Response `yaml:",inline"`
+	Data     []ServerNode `json:"data" yaml:"data"`
+}
+
+// LaunchServers launches all server nodes in a pod given the pod id.
+func (c *ManagerClient) LaunchServers(ctx context.Context, podId string) (*ServerResponse, error) {
+	return c.server(ctx, "launch/", podId)
+}
+
+// PauseServers pauses all server nodes in a pod given the pod id.
+func (c *ManagerClient) PauseServers(ctx context.Context, podId string) (*ServerResponse, error) {
+	return c.server(ctx, "pause/", podId)
+}
+
+// ResumeServers resumes all server nodes in a pod given the pod id.
+func (c *ManagerClient) ResumeServers(ctx context.Context, podId string) (*ServerResponse, error) {
+	return c.server(ctx, "resume/", podId)
+}
+
+func (c *ManagerClient) server(ctx context.Context, action, podId string) (*ServerResponse, error) {
+	params := url.Values{}
+	params.Add("pod_id", podId)
+
+	var response ServerResponse
+	err := c.do(ctx, http.MethodPost, serverEp+action, params, nil, "", &response)
+	return &response, err
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of job abort.
+var (
+	abortAll         bool
+	abortNode        string
+	abortStatus      string
+	abortNamePattern string
+	abortYes         bool
+)
+
+// abortResult is the outcome of aborting a job of a bulk abort.
+type abortResult struct {
+	Id    string `json:"job_id" yaml:"job_id"`
+	Name  string `json:"name" yaml:"name"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	err   error
+}
+
+// hasAbortSelector reports whether jobs to abort are selected with flags
+// rather than by id.
+func hasAbortSelector() bool {
+	return abortAll || abortNode != "" || abortStatus != "" || abortNamePattern != ""
+}
+
+// selectJobs returns the jobs to abort: the jobs with the given ids, or the
+// jobs that are not over and match the selector flags.
+func selectJobs(cmd *cobra.Command, ids []string) ([]client.Job, error) {
+	response, err := manager().ListJobs(cmd.Context(), abortNode)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		byId := map[string]client.Job{}
+		for _, job := range response.Data {
+			byId[job.Id] = job
+		}
+		var jobs []client.Job
+		for _, id := range ids {
+			job, ok := byId[id]
+			if !ok {
+				// Let the manager tell what is wrong with it
+				job = client.Job{Id: id}
+			}
+			jobs = append(jobs, job)
+		}
+		return jobs, nil
+	}
+
+	var jobs []client.Job
+	for _, job := range response.Data {
+		if finished(job.Status) {
+			continue
+		}
+		if abortStatus != "" && job.Status != abortStatus {
+			continue
+		}
+		if abortNamePattern != "" {
+			match, _ := path.Match(abortNamePattern, job.Name)
+			if !match {
+				continue
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// abortJobs aborts the jobs given by id or selected with the flags, once the
+// user confirmed, and prints the result of every abort.
+func abortJobs(cmd *cobra.Command, ids []string) error {
+	if len(ids) > 0 && hasAbortSelector() {
+		return badInputf("give either job ids or --all, --node, --status and --name-pattern, not both")
+	}
+	if len(ids) == 0 && !hasAbortSelector() {
+		return badInputf("give the ids of the jobs to abort, or select them with --all, --node, --status or --name-pattern")
+	}
+	if abortStatus != "" && abortStatus != "running" && abortStatus != "registered" {
+		return badInputf("unknown --status %q, expected running or registered", abortStatus)
+	}
+	if _, err := path.Match(abortNamePattern, ""); err != nil {
+		return badInputf("bad --name-pattern %q: %v", abortNamePattern, err)
+	}
+
+	// Find the jobs
+	jobs, err := selectJobs(cmd, ids)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Fprintln(cmd.ErrOrStderr(), "No jobs found")
+		return nil
+	}
+
+	// Confirm
+	if !abortYes {
+		stderr := cmd.ErrOrStderr()
+		t := newTable("ID", "NAME", "STATUS", "NODE")
+		for _, job := range jobs {
+			t.addRow(job.Id, job.Name, job.Status, job.Node)
+		}
+		t.render(stderr)
+		fmt.Fprintf(stderr, "Abort %d jobs? [y/N] ", len(jobs))
+
+		answer, err := readLine(cmd.Root().Context(), bufio.NewReader(cmd.InOrStdin()))
+		if err == errInterrupted {
+			fmt.Fprintln(stderr)
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(stderr)
+			return badInputf("could not read the answer, pass --yes to abort without asking: %v", err)
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(stderr, "Nothing aborted")
+			return nil
+		}
+	}
+
+	// Send the requests
+	results := make([]abortResult, len(jobs))
+	var failed []error
+	for i, job := range jobs {
+		results[i] = abortResult{Id: job.Id, Name: job.Name}
+
+		ctx, cancel := requestContext(cmd.Root().Context(), cmd)
+		_, err := manager().AbortJob(ctx, job.Id)
+		cancel()
+		if err != nil {
+			results[i].err, results[i].Error = err, err.Error()
+			failed = append(failed, err)
+		}
+	}
+
+	// Print the response
+	var aborted []string
+	for _, result := range results {
+		if result.err == nil {
+			aborted = append(aborted, result.Id)
+		}
+	}
+	response := &cliResponse[[]abortResult]{
+		Status: len(failed) == 0,
+		Msg:    fmt.Sprintf("aborted %d of %d jobs", len(aborted), len(results)),
+		Data:   results,
+	}
+	err = printResponse(cmd, response, aborted, func(w io.Writer) {
+		t := newTable("ID", "NAME", "RESULT")
+		for _, result := range results {
+			outcome := "aborted"
+			if result.err != nil {
+				outcome = result.Error
+			}
+			t.addRow(result.Id, result.Name, outcome)
+		}
+		t.render(w)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not abort %d of %d jobs, the first error: %w", len(failed), len(results), failed[0])
+	}
+	return nil
+}
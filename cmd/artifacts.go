@@ -0,0 +1,289 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of job output.
+var (
+	outputDest string
+	outputTar  string
+	outputList bool
+)
+
+var jobOutputCmd = &cobra.Command{
+	Use:   "output [job_id]",
+	Short: "Download the files produced by a job",
+	Long: `Download the files produced by a job into --dest, a directory named after the
+job by default, or into a gzipped tar archive with --tar, "-" for stdout.
+
+Every file is checked against the checksum given by the manager, a file that
+does not match is not kept and the exit code is 5. An archive is only written,
+or printed, once every file in it matches. --list only lists the
+files. Large outputs may need a longer --timeout than the default 30m.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := args[0]
+		if outputTar == "-" && outputFormat != outputTable {
+			return badInputf("--tar - writes the archive to stdout, it cannot be used with --output %s", outputFormat)
+		}
+
+		// Send the request
+		response, err := manager().ListArtifacts(cmd.Context(), id)
+		if err != nil {
+			return err
+		}
+		for _, artifact := range response.Data {
+			if !safeName(artifact.Name) {
+				return &client.Error{Kind: client.KindMalformed, Err: fmt.Errorf("unsafe file name %q", artifact.Name)}
+			}
+		}
+
+		// Download the files
+		if len(response.Data) > 0 && !outputList {
+			if outputTar != "" {
+				err = downloadTar(cmd, id, response.Data)
+			} else {
+				err = downloadDir(cmd, id, response.Data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if outputTar == "-" {
+			return nil
+		}
+
+		// Print the response
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			if len(response.Data) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No files found")
+				return
+			}
+
+			t := newTable("NAME", "SIZE", "SHA256")
+			for _, artifact := range response.Data {
+				t.addRow(artifact.Name, formatSize(artifact.Size), artifact.Sha256)
+			}
+			t.render(w)
+		})
+	},
+}
+
+// safeName reports whether an artifact name stays within the destination.
+func safeName(name string) bool {
+	clean := path.Clean(name)
+	return name != "" && !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// downloadDir downloads artifacts into --dest, through temporary files so
+// that only complete and verified files are kept.
+func downloadDir(cmd *cobra.Command, id string, artifacts []client.Artifact) error {
+	dest := outputDest
+	if dest == "" {
+		dest = id
+	}
+
+	for _, artifact := range artifacts {
+		target := filepath.Join(dest, filepath.FromSlash(path.Clean(artifact.Name)))
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(target + ".part")
+		if err != nil {
+			return err
+		}
+
+		err = download(cmd, id, artifact, file)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+			return err
+		}
+		err = os.Rename(file.Name(), target)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Downloaded %d files to %s\n", len(artifacts), dest)
+	return nil
+}
+
+// downloadTar downloads artifacts into the gzipped tar archive --tar, or
+// stdout for "-". The archive is written to a temporary file, next to --tar,
+// and only renamed to it or copied to stdout once every file matches its
+// checksum, a failed download leaves nothing behind.
+func downloadTar(cmd *cobra.Command, id string, artifacts []client.Artifact) error {
+	toStdout := outputTar == "-"
+	dir, pattern := filepath.Dir(outputTar), "."+filepath.Base(outputTar)+".*.part"
+	if toStdout {
+		dir, pattern = "", "cloud-output-*.tar.gz"
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return err
+	}
+	err = file.Chmod(0644)
+	if err == nil {
+		err = writeTar(cmd, id, artifacts, file)
+	}
+	if err == nil && toStdout {
+		_, err = file.Seek(0, io.SeekStart)
+		if err == nil {
+			_, err = io.Copy(cmd.OutOrStdout(), file)
+		}
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && !toStdout {
+		err = os.Rename(file.Name(), outputTar)
+	}
+	if err != nil || toStdout {
+		os.Remove(file.Name())
+		return err
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Downloaded %d files to %s\n", len(artifacts), outputTar)
+	return nil
+}
+
+// writeTar writes artifacts to w as a gzipped tar archive.
+func writeTar(cmd *cobra.Command, id string, artifacts []client.Artifact, w io.Writer) error {
+	zipped := gzip.NewWriter(w)
+	archive := tar.NewWriter(zipped)
+	for _, artifact := range artifacts {
+		err := archive.WriteHeader(&tar.Header{
+			Name:    path.Clean(artifact.Name),
+			Size:    artifact.Size,
+			Mode:    0644,
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		err = download(cmd, id, artifact, archive)
+		if err != nil {
+			return err
+		}
+	}
+	err := archive.Close()
+	if err == nil {
+		err = zipped.Close()
+	}
+	return err
+}
+
+// download copies an artifact to w, showing the progress on stderr, and
+// checks its size and checksum.
+func download(cmd *cobra.Command, id string, artifact client.Artifact, w io.Writer) error {
+	body, err := manager().DownloadArtifact(cmd.Context(), id, artifact.Name)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	progress := &transferProgress{w: cmd.ErrOrStderr(), tty: isTerminal(cmd.ErrOrStderr()), name: artifact.Name, total: artifact.Size}
+	n, err := io.Copy(io.MultiWriter(w, hash, progress), body)
+	progress.clear()
+	if errors.Is(err, tar.ErrWriteTooLong) {
+		return &client.Error{Kind: client.KindMalformed, Err: fmt.Errorf("%s is longer than the %d bytes expected", artifact.Name, artifact.Size)}
+	}
+	if err != nil {
+		if client.KindOf(err) != client.KindUnknown {
+			return err
+		}
+		return err
+	}
+
+	if n != artifact.Size {
+		return &client.Error{Kind: client.KindMalformed, Err: fmt.Errorf("%s is %d bytes long, expected %d", artifact.Name, n, artifact.Size)}
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if artifact.Sha256 != "" && !strings.EqualFold(sum, artifact.Sha256) {
+		return &client.Error{Kind: client.KindMalformed, Err: fmt.Errorf("checksum of %s does not match, expected %s, got %s", artifact.Name, artifact.Sha256, sum)}
+	}
+	return nil
+}
+
+// transferProgress shows how much of a file was transferred, on a single
+// line redrawn at most every spinInterval. Nothing is shown if w is not a
+// terminal.
+type transferProgress struct {
+	w     io.Writer
+	tty   bool
+	name  string
+	total int64
+	done  int64
+	drawn time.Time
+}
+
+func (p *transferProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if p.tty && time.Since(p.drawn) >= spinInterval {
+		p.drawn = time.Now()
+		percent := 100
+		if p.total > 0 {
+			percent = int(p.done * 100 / p.total)
+		}
+		fmt.Fprintf(p.w, "\r\033[K%s %s / %s %d%%", p.name, formatSize(p.done), formatSize(p.total), percent)
+	}
+	return len(b), nil
+}
+
+// clear removes the progress line from the terminal.
+func (p *transferProgress) clear() {
+	if p.tty && !p.drawn.IsZero() {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
+
+// formatSize returns n bytes in a human readable unit, e.g. 1.5 MB.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TB", value)
+}
+
+func init() {
+	jobCmd.AddCommand(jobOutputCmd)
+
+	// Outputs may be large
+	setTimeout(jobOutputCmd, 30*time.Minute)
+
+	jobOutputCmd.Flags().StringVar(&outputDest, "dest", "", "directory to download the files to (default ./<job_id>)")
+	jobOutputCmd.Flags().StringVar(&outputTar, "tar", "", "download the files into this gzipped tar archive instead, - for stdout")
+	jobOutputCmd.Flags().BoolVar(&outputList, "list", false, "only list the files")
+}
@@ -0,0 +1,276 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/history"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags of job launch for batches.
+var (
+	launchManifest string
+	launchGlobs    []string
+	launchParallel int
+)
+
+// manifestJob is an entry of a jobs manifest.
+type manifestJob struct {
+	Name   string `yaml:"name"`
+	Script string `yaml:"script"`
+	Count  int    `yaml:"count"`
+}
+
+// launchSpec is a single job to launch.
+type launchSpec struct {
+	name   string
+	script string
+	// filename is the name the script is uploaded under, that of script if
+	// empty
+	filename string
+	// content is the script to upload, read from script if nil
+	content []byte
+	// sha256 is that of a script kept in the history, uploaded instead of
+	// script
+	sha256 string
+	// jobSpec is how the job is run, left to the manager if nil
+	jobSpec *client.JobSpec
+}
+
+// launchResult is the outcome of launching a job of a batch.
+type launchResult struct {
+	Name   string `json:"name" yaml:"name"`
+	Script string `json:"script" yaml:"script"`
+	Id     string `json:"job_id,omitempty" yaml:"job_id,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+	err    error
+}
+
+// isBatch reports whether job launch was given a manifest or globs instead of
+// a single job.
+func isBatch() bool {
+	return launchManifest != "" || len(launchGlobs) > 0
+}
+
+// readManifest reads the jobs of the manifest at path. Scripts are relative
+// to the manifest and an entry with a count above 1 gives jobs named
+// <name>-1 to <name>-<count>.
+func readManifest(path string) ([]launchSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, badInput(err)
+	}
+
+	var entries []manifestJob
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&entries)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, badInputf("could not parse %s: %v", path, err)
+	}
+
+	var specs []launchSpec
+	for i, entry := range entries {
+		switch {
+		case entry.Name == "":
+			return nil, badInputf("%s: entry %d has no name", path, i+1)
+		case entry.Script == "":
+			return nil, badInputf("%s: entry %d has no script", path, i+1)
+		case entry.Count < 0:
+			return nil, badInputf("%s: entry %d has a negative count", path, i+1)
+		}
+
+		script := entry.Script
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(filepath.Dir(path), script)
+		}
+		if entry.Count <= 1 {
+			specs = append(specs, launchSpec{name: entry.Name, script: script})
+			continue
+		}
+		for n := 1; n <= entry.Count; n++ {
+			specs = append(specs, launchSpec{name: entry.Name + "-" + strconv.Itoa(n), script: script})
+		}
+	}
+	return specs, nil
+}
+
+// globScripts returns a job per script matching pattern, named after the
+// script without its extension.
+func globScripts(pattern string) ([]launchSpec, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, badInputf("bad pattern %q: %v", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, badInputf("no script matches %q", pattern)
+	}
+
+	var specs []launchSpec
+	for _, match := range matches {
+		base := filepath.Base(match)
+		specs = append(specs, launchSpec{name: strings.TrimSuffix(base, filepath.Ext(base)), script: match})
+	}
+	return specs, nil
+}
+
+// launchBatch launches the jobs of --filename and --glob, --parallel at a
+// time, and prints a summary.
+func launchBatch(cmd *cobra.Command, jobSpec *client.JobSpec) error {
+	if launchWait {
+		return badInputf("--wait follows a single job, it cannot be used with --filename or --glob")
+	}
+	if launchParallel < 1 {
+		return badInputf("--parallel must be at least 1")
+	}
+	if len(launchFiles) > 0 || launchEntrypoint != "" {
+		return badInputf("--file and --entrypoint add files to a single job, they cannot be used with --filename or --glob")
+	}
+
+	// Collect the jobs
+	var specs []launchSpec
+	if launchManifest != "" {
+		manifest, err := readManifest(launchManifest)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, manifest...)
+	}
+	for _, pattern := range launchGlobs {
+		matches, err := globScripts(pattern)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, matches...)
+	}
+	if len(specs) == 0 {
+		return badInputf("no jobs to launch")
+	}
+	for i := range specs {
+		specs[i].jobSpec = jobSpec
+	}
+
+	// Check every script before launching anything
+	for _, spec := range specs {
+		info, err := os.Stat(spec.script)
+		if err != nil {
+			return badInput(err)
+		}
+		if info.IsDir() {
+			return badInputf("%s is a directory, not a script", spec.script)
+		}
+	}
+
+	// Send the requests
+	results := launchAll(cmd, specs)
+
+	// Print the response
+	var ids []string
+	var failed []error
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.err)
+		} else {
+			ids = append(ids, result.Id)
+		}
+	}
+	response := &cliResponse[[]launchResult]{
+		Status: len(failed) == 0,
+		Msg:    fmt.Sprintf("launched %d of %d jobs", len(ids), len(results)),
+		Data:   results,
+	}
+	err := printResponse(cmd, response, ids, func(w io.Writer) {
+		t := newTable("NAME", "SCRIPT", "JOB ID", "ERROR")
+		for _, result := range results {
+			t.addRow(result.Name, result.Script, result.Id, result.Error)
+		}
+		t.render(w)
+		fmt.Fprintf(cmd.ErrOrStderr(), "Launched %d of %d jobs\n", len(ids), len(results))
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not launch %d of %d jobs, the first error: %w", len(failed), len(results), failed[0])
+	}
+	return nil
+}
+
+// launchAll launches the jobs of specs, --parallel at a time, and returns
+// the results in the order of specs.
+func launchAll(cmd *cobra.Command, specs []launchSpec) []launchResult {
+	results := make([]launchResult, len(specs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < launchParallel && w < len(specs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = launchOne(cmd, specs[i])
+			}
+		}()
+	}
+	for i := range specs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// launchOne launches the job of spec.
+func launchOne(cmd *cobra.Command, spec launchSpec) launchResult {
+	result := launchResult{Name: spec.name, Script: spec.script}
+
+	filename := spec.filename
+	if filename == "" {
+		filename = filepath.Base(spec.script)
+	}
+	open := func() (io.ReadCloser, error) {
+		return os.Open(spec.script)
+	}
+	if spec.content != nil {
+		open = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(spec.content)), nil
+		}
+	}
+	path, err := absPath(spec.script)
+	if err != nil {
+		path = spec.script
+	}
+	sub := &history.Submission{Name: spec.name, Script: path, Filename: filename, Sha256: spec.sha256, Spec: spec.jobSpec}
+	upload, err := scriptUpload(cmd, sub, filename, open)
+	if err != nil {
+		result.err, result.Error = err, err.Error()
+		return result
+	}
+	upload.Spec = spec.jobSpec
+
+	ctx, cancel := requestContext(cmd.Root().Context(), cmd)
+	defer cancel()
+	response, err := manager().LaunchJobUpload(ctx, spec.name, upload)
+	if err != nil {
+		result.err, result.Error = err, err.Error()
+		return result
+	}
+	result.Id = response.Data.Id
+	sub.Id = result.Id
+	recordSubmission(cmd, sub)
+	return result
+}
@@ -0,0 +1,404 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"awsonbudget/cli/client"
+)
+
+// Flags of job launch for bundles.
+var (
+	launchFiles      []string
+	launchEntrypoint string
+	launchMaxBundle  string
+)
+
+// ignoreFile lists the files left out of a bundle, in the directory of the
+// bundle. It is left out as well.
+const ignoreFile = ".cloudignore"
+
+// bundleFile is a file of a bundle.
+type bundleFile struct {
+	// name is the slash separated path of the file in the bundle
+	name   string
+	source string
+	info   fs.FileInfo
+}
+
+// bundleSpec is what a bundle is made of: a directory and the script to run
+// in it, or a script and other files.
+type bundleSpec struct {
+	script string
+	files  []string
+	// entrypoint is the script to run in a directory, found in it if empty
+	entrypoint string
+}
+
+// bundle is the set of files uploaded with a job, as a gzipped tar archive.
+type bundle struct {
+	files []bundleFile
+	names map[string]string
+	size  int64
+}
+
+// isBundle reports whether job launch was given a directory or extra files
+// rather than a single script.
+func isBundle(script string) bool {
+	if len(launchFiles) > 0 || launchEntrypoint != "" {
+		return true
+	}
+	info, err := os.Stat(script)
+	return err == nil && info.IsDir()
+}
+
+// bundleUpload collects the files of the bundle of spec and returns what to
+// upload.
+func bundleUpload(spec bundleSpec) (*client.JobUpload, *bundle, error) {
+	script := spec.script
+	info, err := os.Stat(script)
+	if err != nil {
+		return nil, nil, badInput(err)
+	}
+
+	b := &bundle{names: map[string]string{}}
+	var entrypoint string
+	if info.IsDir() {
+		if len(spec.files) > 0 {
+			return nil, nil, badInputf("--file adds files to a script, %s is a directory", script)
+		}
+		ignore, err := readIgnore(filepath.Join(script, ignoreFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		err = b.addDir(script, "", ignore)
+		if err != nil {
+			return nil, nil, err
+		}
+		entrypoint, err = b.entrypoint(script, spec.entrypoint)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if spec.entrypoint != "" && spec.entrypoint != filepath.Base(script) {
+			return nil, nil, badInputf("--entrypoint picks the script of a directory, %s is a script", script)
+		}
+		root := filepath.Dir(script)
+		ignore, err := readIgnore(filepath.Join(root, ignoreFile))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entrypoint = filepath.Base(script)
+		err = b.add(entrypoint, script, info)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range spec.files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, nil, badInput(err)
+			}
+			name := bundleName(root, file)
+			if info.IsDir() {
+				err = b.addDir(file, name, ignore)
+			} else {
+				err = b.add(name, file, info)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Check the size before sending anything
+	limit, err := parseSize(launchMaxBundle)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.size > limit {
+		return nil, nil, badInputf("the files of the job take %s, more than the %s allowed by --max-bundle-size, leave some out with %s",
+			formatSize(b.size), formatSize(limit), ignoreFile)
+	}
+
+	upload := &client.JobUpload{
+		Filename:   path.Base(entrypoint),
+		OpenBundle: b.open,
+		Entrypoint: entrypoint,
+	}
+	return upload, b, nil
+}
+
+// bundleName returns the name in the bundle of file, relative to root if it
+// is inside it, or its base name otherwise.
+func bundleName(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// add adds the file at source to the bundle under name.
+func (b *bundle) add(name, source string, info fs.FileInfo) error {
+	if other, ok := b.names[name]; ok {
+		return badInputf("%s and %s would both be %s in the bundle", other, source, name)
+	}
+	if !info.Mode().IsRegular() {
+		return badInputf("%s is not a regular file", source)
+	}
+	b.names[name] = source
+	b.files = append(b.files, bundleFile{name: name, source: source, info: info})
+	b.size += info.Size()
+	return nil
+}
+
+// addDir adds the files of dir to the bundle under prefix, but for those
+// ignored. Symbolic links to files are followed, to directories skipped.
+func (b *bundle) addDir(dir, prefix string, ignore ignoreRules) error {
+	return filepath.WalkDir(dir, func(source string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return badInput(err)
+		}
+		rel, err := filepath.Rel(dir, source)
+		if err != nil {
+			return badInput(err)
+		}
+		if rel == "." {
+			return nil
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if name == ignoreFile {
+			return nil
+		}
+
+		info, err := os.Stat(source)
+		if err != nil {
+			return badInput(err)
+		}
+		if ignore.ignored(name, info.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return b.add(name, source, info)
+	})
+}
+
+// entrypoint returns the script to run in a bundle made of the directory dir:
+// given, run.sh or the only .sh file at the top of the directory.
+func (b *bundle) entrypoint(dir, given string) (string, error) {
+	if given != "" {
+		name := path.Clean(filepath.ToSlash(given))
+		if _, ok := b.names[name]; !ok {
+			return "", badInputf("%s is not in %s, or is ignored", given, dir)
+		}
+		return name, nil
+	}
+	if _, ok := b.names["run.sh"]; ok {
+		return "run.sh", nil
+	}
+
+	var scripts []string
+	for _, file := range b.files {
+		if !strings.Contains(file.name, "/") && strings.HasSuffix(file.name, ".sh") {
+			scripts = append(scripts, file.name)
+		}
+	}
+	if len(scripts) != 1 {
+		return "", badInputf("cannot tell which script of %s to run, give it with --entrypoint", dir)
+	}
+	return scripts[0], nil
+}
+
+// open streams the bundle as a gzipped tar archive.
+func (b *bundle) open() (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(b.write(writer))
+	}()
+	return reader, nil
+}
+
+func (b *bundle) write(w io.Writer) error {
+	zipped := gzip.NewWriter(w)
+	archive := tar.NewWriter(zipped)
+	for _, file := range b.files {
+		err := archive.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    int64(file.info.Mode().Perm()),
+			Size:    file.info.Size(),
+			ModTime: file.info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+		err = copyFile(archive, file)
+		if err != nil {
+			return err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+// sums returns the hex encoded SHA-256 of every file of the bundle, by name.
+func (b *bundle) sums() (map[string]string, error) {
+	sums := map[string]string{}
+	for _, file := range b.files {
+		hash := sha256.New()
+		err := copyFile(hash, file)
+		if err != nil {
+			return nil, badInput(err)
+		}
+		sums[file.name] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return sums, nil
+}
+
+// copyFile copies the content of file to w, as long as it did not change size
+// since it was added.
+func copyFile(w io.Writer, file bundleFile) error {
+	f, err := os.Open(file.source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// A file that shrank ends early, one that grew has more to read
+	size := file.info.Size()
+	n, err := io.CopyN(w, f, size)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n == size {
+		extra, err := f.Read(make([]byte, 1))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		n += int64(extra)
+	}
+	if n != size {
+		return fmt.Errorf("%s changed while it was uploaded", file.source)
+	}
+	return nil
+}
+
+// ignoreRule is a pattern of a .cloudignore file.
+type ignoreRule struct {
+	pattern string
+	// negate includes again what an earlier rule left out
+	negate bool
+	// dirOnly matches directories only, for patterns ending with a slash
+	dirOnly bool
+	// anchored matches the whole path rather than the base name, for
+	// patterns with a slash
+	anchored bool
+}
+
+type ignoreRules []ignoreRule
+
+// readIgnore reads the rules of the .cloudignore file at path, if any. It
+// follows the basics of .gitignore: a line per pattern, # for comments, ! to
+// include a file again, a trailing / for directories and a / elsewhere to
+// match the path from the top of the bundle instead of the base name.
+func readIgnore(file string) (ignoreRules, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, badInput(err)
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(text, "!") {
+			rule.negate, text = true, text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			rule.dirOnly, text = true, strings.TrimSuffix(text, "/")
+		}
+		if strings.Contains(text, "/") {
+			rule.anchored, text = true, strings.TrimPrefix(text, "/")
+		}
+		if _, err := path.Match(text, ""); err != nil || text == "" {
+			return nil, badInputf("%s:%d: bad pattern %q", file, line, scanner.Text())
+		}
+		rule.pattern = text
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, badInput(err)
+	}
+	return rules, nil
+}
+
+// ignored reports whether the file or directory name of a bundle is left out.
+// The last rule that matches wins.
+func (rules ignoreRules) ignored(name string, dir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		subject := path.Base(name)
+		if rule.anchored {
+			subject = name
+		}
+		if match, _ := path.Match(rule.pattern, subject); match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// parseSize parses a size such as 100MB, 1.5GB or 2048.
+func parseSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for i, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(text, suffix) {
+			text = strings.TrimSuffix(text, suffix)
+			multiplier = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, "B"))
+
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, badInputf("bad size %q, expected e.g. 100MB", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
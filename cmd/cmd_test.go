@@ -0,0 +1,1506 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/fakemanager"
+	"awsonbudget/cli/history"
+	"awsonbudget/cli/schedule"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// result is the outcome of a single run of the cli.
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// newManager starts a fake manager for the duration of the test. The test
+// also gets its own empty config file.
+func newManager(t *testing.T) (*fakemanager.Manager, string) {
+	t.Helper()
+
+	t.Setenv("CLOUD_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+
+	manager := fakemanager.New()
+	server := httptest.NewServer(manager)
+	t.Cleanup(server.Close)
+	return manager, server.URL
+}
+
+// cloud runs the cli with args against the manager at url, with stdin as
+// its standard input.
+func cloud(t *testing.T, url string, stdin string, args ...string) result {
+	t.Helper()
+
+	t.Setenv("MANAGER", "")
+	t.Setenv("CLOUD_CONTEXT", "")
+	t.Setenv("CLOUD_TOKEN", "")
+	resetFlags(rootCmd)
+
+	var stdout, stderr bytes.Buffer
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(&stderr)
+	rootCmd.SetIn(strings.NewReader(stdin))
+
+	if url != "" {
+		args = append([]string{"--manager", url}, args...)
+	}
+	code := run(context.Background(), args)
+	return result{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+// mustCloud is cloud for runs expected to succeed.
+func mustCloud(t *testing.T, url string, args ...string) string {
+	t.Helper()
+
+	res := cloud(t, url, "", args...)
+	if res.code != ExitOK {
+		t.Fatalf("cloud %s: exit code %d, stderr: %s", strings.Join(args, " "), res.code, res.stderr)
+	}
+	return res.stdout
+}
+
+// resetFlags puts back every flag to its default, since the commands are
+// package level variables shared by every run.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+func TestInit(t *testing.T) {
+	_, url := newManager(t)
+
+	out := mustCloud(t, url, "init")
+	if !strings.Contains(out, "Success: cloud initialized") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	out = mustCloud(t, url, "pod", "ls", "-o", "id")
+	if out != "pod-1\n" {
+		t.Errorf("expected the default pod, got %q", out)
+	}
+}
+
+func TestPod(t *testing.T) {
+	_, url := newManager(t)
+
+	mustCloud(t, url, "pod", "register", "server", "web")
+	out := mustCloud(t, url, "pod", "ls")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "web") {
+		t.Errorf("unexpected table: %q", out)
+	}
+
+	out = mustCloud(t, url, "pod", "ls", "--no-headers")
+	if strings.HasPrefix(out, "ID") {
+		t.Errorf("headers printed with --no-headers: %q", out)
+	}
+
+	var response struct {
+		Status bool `json:"status"`
+		Data   []struct {
+			Id   string `json:"pod_id"`
+			Type string `json:"pod_type"`
+		} `json:"data"`
+	}
+	out = mustCloud(t, url, "pod", "ls", "-o", "json")
+	err := json.Unmarshal([]byte(out), &response)
+	if err != nil {
+		t.Fatalf("invalid json %q: %v", out, err)
+	}
+	if !response.Status || len(response.Data) != 1 || response.Data[0].Type != "server" {
+		t.Errorf("unexpected json: %q", out)
+	}
+
+	out = mustCloud(t, url, "pod", "ls", "-o", "yaml")
+	if !strings.Contains(out, "pod_type: server") {
+		t.Errorf("unexpected yaml: %q", out)
+	}
+
+	res := cloud(t, url, "", "pod", "register", "server", "web")
+	if res.code != ExitRejected || !strings.Contains(res.stderr, "already exists") {
+		t.Errorf("duplicate pod: exit code %d, stderr %q", res.code, res.stderr)
+	}
+
+	mustCloud(t, url, "pod", "rm", response.Data[0].Id)
+	res = cloud(t, url, "", "pod", "ls")
+	if res.code != ExitOK || res.stdout != "" || !strings.Contains(res.stderr, "No pods found") {
+		t.Errorf("unexpected empty list: %+v", res)
+	}
+}
+
+func TestNode(t *testing.T) {
+	_, url := newManager(t)
+	mustCloud(t, url, "init")
+
+	mustCloud(t, url, "node", "register", "job", "worker", "pod-1")
+	out := mustCloud(t, url, "node", "ls", "pod-1", "--wide")
+	if !strings.Contains(out, "POD ID") || !strings.Contains(out, "worker") {
+		t.Errorf("unexpected table: %q", out)
+	}
+
+	out = mustCloud(t, url, "node", "log", "node-2")
+	if !strings.Contains(out, "registered in pod pod-1") {
+		t.Errorf("unexpected log: %q", out)
+	}
+
+	res := cloud(t, url, "", "node", "register", "server", "web", "pod-1")
+	if res.code != ExitRejected {
+		t.Errorf("server node in a job pod: exit code %d", res.code)
+	}
+
+	mustCloud(t, url, "node", "rm", "node-2")
+	res = cloud(t, url, "", "node", "rm", "node-2")
+	if res.code != ExitRejected || !strings.Contains(res.stderr, "not found") {
+		t.Errorf("removed twice: exit code %d, stderr %q", res.code, res.stderr)
+	}
+}
+
+func TestJob(t *testing.T) {
+	manager, url := newManager(t)
+
+	script := filepath.Join(t.TempDir(), "hello.sh")
+	err := os.WriteFile(script, []byte("echo hello\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustCloud(t, url, "job", "launch", "hello", script, "-o", "id")
+	id := strings.TrimSpace(out)
+	if manager.Script(id) != "echo hello\n" {
+		t.Errorf("script not uploaded, got %q", manager.Script(id))
+	}
+
+	out = mustCloud(t, url, "job", "ls")
+	if !strings.Contains(out, id) || !strings.Contains(out, "registered") {
+		t.Errorf("unexpected table: %q", out)
+	}
+
+	mustCloud(t, url, "job", "abort", id)
+	out = mustCloud(t, url, "job", "log", id)
+	if !strings.Contains(out, "aborted") {
+		t.Errorf("unexpected log: %q", out)
+	}
+
+	res := cloud(t, url, "", "job", "abort", id)
+	if res.code != ExitRejected {
+		t.Errorf("aborted twice: exit code %d", res.code)
+	}
+
+	res = cloud(t, url, "", "job", "launch", "missing", filepath.Join(t.TempDir(), "missing.sh"))
+	if res.code != ExitUsage {
+		t.Errorf("missing script: exit code %d", res.code)
+	}
+}
+
+func TestSimulatedJobs(t *testing.T) {
+	t.Setenv("CLOUD_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	manager, err := fakemanager.Open(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.JobDuration = 50 * time.Millisecond
+	server := httptest.NewServer(manager)
+	defer server.Close()
+	url := server.URL
+
+	script := filepath.Join(t.TempDir(), "fail.sh")
+	err = os.WriteFile(script, []byte("echo failing\nexit 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "worker", "pod-1")
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "fail", script, "-o", "id"))
+	out := mustCloud(t, url, "job", "ls")
+	if !strings.Contains(out, "running") {
+		t.Errorf("job not started: %q", out)
+	}
+
+	time.Sleep(2 * manager.JobDuration)
+	out = mustCloud(t, url, "job", "ls")
+	if !strings.Contains(out, "failed") {
+		t.Errorf("job not failed: %q", out)
+	}
+	out = mustCloud(t, url, "job", "log", id)
+	if !strings.Contains(out, "+ echo failing") {
+		t.Errorf("script not in the log: %q", out)
+	}
+
+	// A new manager picks up the saved state
+	reopened, err := fakemanager.Open(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = httptest.NewServer(reopened)
+	defer server.Close()
+	out = mustCloud(t, server.URL, "job", "ls", "-o", "id")
+	if out != id+"\n" {
+		t.Errorf("state not restored, got %q", out)
+	}
+}
+
+func TestLaunchBatch(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"scripts/a.sh": "echo a\n",
+		"scripts/b.sh": "echo b\n",
+		"jobs.yaml":    "- name: train\n  script: scripts/a.sh\n  count: 2\n- name: report\n  script: scripts/b.sh\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := mustCloud(t, url, "job", "launch", "-f", filepath.Join(dir, "jobs.yaml"), "--glob", filepath.Join(dir, "scripts", "*.sh"), "--parallel", "2")
+	for _, name := range []string{"train-1", "train-2", "report", "a ", "b "} {
+		if !strings.Contains(out, name) {
+			t.Errorf("%s not in the summary: %q", name, out)
+		}
+	}
+	out = mustCloud(t, url, "job", "ls", "-o", "id")
+	ids := strings.Fields(out)
+	if len(ids) != 5 {
+		t.Fatalf("expected 5 jobs, got %q", out)
+	}
+	if script := manager.Script(ids[0]); script != "echo a\n" && script != "echo b\n" {
+		t.Errorf("unexpected script %q", script)
+	}
+
+	res := cloud(t, url, "", "job", "launch", "--glob", filepath.Join(dir, "missing-*"))
+	if res.code != ExitUsage {
+		t.Errorf("no match: exit code %d", res.code)
+	}
+}
+
+func TestJobSweep(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "train.sh.tmpl")
+	err := os.WriteFile(tmpl, []byte("train --lr {{.lr}} --depth {{.depth}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := filepath.Join(dir, "sweep.json")
+
+	mustCloud(t, url, "job", "sweep", "train", tmpl, "--param", "lr=0.1,0.01", "--param", "depth=2,4", "--record", record)
+
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sweep sweepRecord
+	err = json.Unmarshal(data, &sweep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sweep.Jobs) != 4 {
+		t.Fatalf("expected 4 jobs, got %d", len(sweep.Jobs))
+	}
+	last := sweep.Jobs[3]
+	if last.Name != "train-4" || last.Params["lr"] != "0.01" || last.Params["depth"] != "4" {
+		t.Errorf("unexpected job %+v", last)
+	}
+	if script := manager.Script(last.Id); script != "train --lr 0.01 --depth 4\n" {
+		t.Errorf("unexpected script %q", script)
+	}
+
+	res := cloud(t, url, "", "job", "sweep", "train", tmpl, "--param", "lr=1", "--record", filepath.Join(dir, "other.json"))
+	if res.code != ExitUsage {
+		t.Errorf("missing parameter: exit code %d", res.code)
+	}
+
+	// The history has the template and the rendered script
+	var listed cliResponse[[]history.Submission]
+	err = json.Unmarshal([]byte(mustCloud(t, url, "job", "history", "-o", "json")), &listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Data) != 4 || listed.Data[3].Script != tmpl || listed.Data[3].Filename != "train.sh" {
+		t.Fatalf("unexpected history %+v", listed.Data)
+	}
+	if rerun := strings.TrimSpace(mustCloud(t, url, "job", "rerun", last.Id, "-o", "id")); manager.Script(rerun) != "train --lr 0.01 --depth 4\n" {
+		t.Errorf("unexpected script of the rerun %q", manager.Script(rerun))
+	}
+
+	// The record is not overwritten
+	res = cloud(t, url, "", "job", "sweep", "train", tmpl, "--param", "lr=1", "--param", "depth=1", "--record", record)
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "--force") {
+		t.Errorf("existing record: exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	mustCloud(t, url, "job", "sweep", "train", tmpl, "--param", "lr=1", "--param", "depth=1", "--record", record, "--force")
+
+	// The jobs are printed even if the record cannot be written
+	res = cloud(t, url, "", "job", "sweep", "train", tmpl, "--param", "lr=1", "--param", "depth=1", "--record", filepath.Join(dir, "missing", "sweep.json"), "-o", "id")
+	if res.code != ExitError || res.stdout == "" || !strings.Contains(res.stderr, "could not record") {
+		t.Errorf("unwritable record: exit code %d, stdout %q, stderr: %s", res.code, res.stdout, res.stderr)
+	}
+
+	// Nothing is recorded when no job was launched
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	none := filepath.Join(dir, "none.json")
+	res = cloud(t, down.URL, "", "job", "sweep", "train", tmpl, "--param", "lr=1", "--param", "depth=1", "--record", none)
+	if res.code == ExitOK {
+		t.Errorf("launched with the manager down, stderr: %s", res.stderr)
+	}
+	if _, err := os.Stat(none); err == nil {
+		t.Errorf("%s recorded without any job", none)
+	}
+
+	// Every parameter needs values
+	params := filepath.Join(dir, "params.yaml")
+	err = os.WriteFile(params, []byte("lr: []\ndepth: [1, 2]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = cloud(t, url, "", "job", "sweep", "train", tmpl, "--params-file", params, "--record", filepath.Join(dir, "empty.json"))
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "no values") {
+		t.Errorf("empty parameter: exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestPromptInterrupted(t *testing.T) {
+	_, url := newManager(t)
+
+	script := filepath.Join(t.TempDir(), "job.sh")
+	err := os.WriteFile(script, []byte("echo job\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCloud(t, url, "job", "launch", "train", script)
+
+	// Ctrl-C at a prompt that nobody answers
+	for _, args := range [][]string{
+		{"job", "abort", "--all"},
+		{"login", "--username", "bob"},
+		{"login", "--token-stdin"},
+	} {
+		resetFlags(rootCmd)
+		stdin, answer := io.Pipe()
+		var stderr bytes.Buffer
+		rootCmd.SetIn(stdin)
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(&stderr)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		timer := time.AfterFunc(100*time.Millisecond, cancel)
+		code := run(ctx, append([]string{"--manager", url}, args...))
+		timer.Stop()
+		cancel()
+		answer.Close()
+		if code != ExitInterrupted {
+			t.Errorf("%v: exit code %d, stderr: %s", args, code, stderr.String())
+		}
+	}
+}
+
+func TestJobAbortBulk(t *testing.T) {
+	manager, url := newManager(t)
+
+	script := filepath.Join(t.TempDir(), "job.sh")
+	err := os.WriteFile(script, []byte("echo job\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"train-1", "train-2", "report"} {
+		mustCloud(t, url, "job", "launch", name, script)
+	}
+	manager.SetJobStatus("job-2", fakemanager.JobRunning)
+
+	// Declined
+	res := cloud(t, url, "n\n", "job", "abort", "--name-pattern", "train-*")
+	if res.code != ExitOK || !strings.Contains(res.stderr, "Abort 2 jobs?") || !strings.Contains(res.stderr, "Nothing aborted") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+
+	res = cloud(t, url, "y\n", "job", "abort", "--status", "registered", "--name-pattern", "train-*")
+	if res.code != ExitOK || !strings.Contains(res.stdout, "job-1") || strings.Contains(res.stdout, "job-2") {
+		t.Errorf("exit code %d, stdout: %s", res.code, res.stdout)
+	}
+
+	// No answer and no --yes
+	res = cloud(t, url, "", "job", "abort", "--all")
+	if res.code != ExitUsage {
+		t.Errorf("unconfirmed: exit code %d", res.code)
+	}
+
+	out := mustCloud(t, url, "job", "abort", "--all", "--yes", "-o", "id")
+	if out != "job-2\njob-3\n" {
+		t.Errorf("unexpected jobs aborted: %q", out)
+	}
+
+	res = cloud(t, url, "", "job", "abort", "job-1", "job-9", "--yes")
+	if res.code != ExitRejected || !strings.Contains(res.stdout, "job-9") {
+		t.Errorf("exit code %d, stdout: %s", res.code, res.stdout)
+	}
+}
+
+func TestJobOutput(t *testing.T) {
+	manager, url := newManager(t)
+
+	script := filepath.Join(t.TempDir(), "job.sh")
+	err := os.WriteFile(script, []byte("echo job\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCloud(t, url, "job", "launch", "job", script)
+	manager.SetArtifact("job-1", "results/metrics.csv", "loss,0.1\n")
+
+	dest := t.TempDir()
+	mustCloud(t, url, "job", "output", "job-1", "--dest", dest)
+	data, err := os.ReadFile(filepath.Join(dest, "results", "metrics.csv"))
+	if err != nil || string(data) != "loss,0.1\n" {
+		t.Errorf("unexpected file %q: %v", data, err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "out.tar.gz")
+	mustCloud(t, url, "job", "output", "job-1", "--tar", archive)
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zipped, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := tar.NewReader(zipped).Next()
+	if err != nil || header.Name != "results/metrics.csv" {
+		t.Errorf("unexpected archive entry %v: %v", header, err)
+	}
+
+	// A file that does not match its checksum is not kept
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cloud/job/output/file/" {
+			io.WriteString(w, "loss,9.9\n")
+			return
+		}
+		manager.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	dest = t.TempDir()
+	res := cloud(t, server.URL, "", "job", "output", "job-1", "--dest", dest)
+	if res.code != ExitMalformed || !strings.Contains(res.stderr, "checksum") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "results", "metrics.csv")); err == nil {
+		t.Errorf("corrupted file kept")
+	}
+
+	// Nor is an archive, not even partially written
+	dest = t.TempDir()
+	archive = filepath.Join(dest, "out.tar.gz")
+	res = cloud(t, server.URL, "", "job", "output", "job-1", "--tar", archive)
+	if res.code != ExitMalformed || !strings.Contains(res.stderr, "checksum") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	if entries, err := os.ReadDir(dest); err != nil || len(entries) != 0 {
+		t.Errorf("corrupted archive kept: %v %v", entries, err)
+	}
+	res = cloud(t, server.URL, "", "job", "output", "job-1", "--tar", "-")
+	if res.code != ExitMalformed || res.stdout != "" {
+		t.Errorf("exit code %d, %d bytes on stdout", res.code, len(res.stdout))
+	}
+	out := mustCloud(t, url, "job", "output", "job-1", "--tar", "-")
+	zipped, err = gzip.NewReader(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err = tar.NewReader(zipped).Next()
+	if err != nil || header.Name != "results/metrics.csv" {
+		t.Errorf("unexpected archive entry %v: %v", header, err)
+	}
+}
+
+func TestLaunchBundle(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"proj/train.sh":     "python train.py\n",
+		"proj/train.py":     "print('train')\n",
+		"proj/data/in.csv":  "1,2\n",
+		"proj/cache/tmp":    "cached\n",
+		"proj/debug.log":    "debug\n",
+		"proj/.cloudignore": "# not needed\n*.log\ncache/\n",
+		"shared/util.py":    "pass\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	proj := filepath.Join(dir, "proj")
+
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "train", proj, "-o", "id"))
+	names, entrypoint := manager.Bundle(id)
+	want := []string{"data/in.csv", "train.py", "train.sh"}
+	if strings.Join(names, " ") != strings.Join(want, " ") || entrypoint != "train.sh" {
+		t.Errorf("unexpected bundle %v, entrypoint %q", names, entrypoint)
+	}
+	if manager.Script(id) != "python train.py\n" {
+		t.Errorf("unexpected script %q", manager.Script(id))
+	}
+
+	id = strings.TrimSpace(mustCloud(t, url, "job", "launch", "train", filepath.Join(proj, "train.sh"),
+		"--file", filepath.Join(proj, "train.py"), "--file", filepath.Join(dir, "shared", "util.py"), "-o", "id"))
+	names, _ = manager.Bundle(id)
+	if strings.Join(names, " ") != "train.sh train.py util.py" {
+		t.Errorf("unexpected bundle %v", names)
+	}
+
+	// A file that changed size since it was added is not cut short
+	for _, content := range []string{"print('train')\nprint('more')\n", "p\n"} {
+		source := filepath.Join(proj, "train.py")
+		info, err := os.Stat(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(source, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = copyFile(io.Discard, bundleFile{name: "train.py", source: source, info: info})
+		if err == nil || !strings.Contains(err.Error(), "changed") {
+			t.Errorf("%q: unexpected error %v", content, err)
+		}
+		err = os.WriteFile(source, []byte(files["proj/train.py"]), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The script is sent once, inside the bundle
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/cloud/job/" {
+			err := r.ParseMultipartForm(1 << 20)
+			if err != nil || r.MultipartForm.File["job_script"] != nil || r.MultipartForm.File["job_bundle"] == nil {
+				http.Error(w, "unexpected upload", http.StatusBadRequest)
+				return
+			}
+		}
+		manager.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	mustCloud(t, server.URL, "job", "launch", "train", proj)
+
+	// An upload given up before sending anything closes the script
+	closed := make(chan bool, 1)
+	upload := &client.JobUpload{Filename: "train.sh", OpenScript: func() (io.ReadCloser, error) {
+		return &closeRecorder{Reader: strings.NewReader("echo\n"), closed: closed}, nil
+	}}
+	_, err := client.New("", nil).LaunchJobUpload(context.Background(), "train", upload)
+	if !errors.Is(err, client.ErrNoEndpoint) {
+		t.Errorf("unexpected error %v", err)
+	}
+	_, err = client.New("http://%zz", nil).LaunchJobUpload(context.Background(), "train", upload)
+	if err == nil {
+		t.Error("no error for a bad url")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("script left open")
+	}
+
+	// Nothing to upload
+	_, err = client.New(url, nil).LaunchJobUpload(context.Background(), "train", &client.JobUpload{Filename: "train.sh"})
+	if !errors.Is(err, client.ErrNoScript) || exitCode(err) != ExitUsage {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	res := cloud(t, url, "", "job", "launch", "train", proj, "--max-bundle-size", "10B")
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "--max-bundle-size") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+// closeRecorder reports on closed when it is closed.
+type closeRecorder struct {
+	io.Reader
+	closed chan bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed <- true
+	return nil
+}
+
+func TestLaunchSpec(t *testing.T) {
+	_, url := newManager(t)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "train.sh")
+	envFile := filepath.Join(dir, "train.env")
+	for path, content := range map[string]string{script: "python train.py \"$@\"\n", envFile: "A=1\nB=from file\n"} {
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "train", script, "--env-file", envFile, "-e", "A=2",
+		"--cpu", "0.5", "--memory", "1GB", "--job-timeout", "1h", "-o", "id", "--", "--lr", "0.1 x"))
+	var described struct {
+		Data client.Job `json:"data"`
+	}
+	err := json.Unmarshal([]byte(mustCloud(t, url, "job", "describe", id, "-o", "json")), &described)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := client.JobSpec{
+		Env:     map[string]string{"A": "2", "B": "from file"},
+		Args:    []string{"--lr", "0.1 x"},
+		CPU:     0.5,
+		Memory:  1 << 30,
+		Timeout: 3600,
+	}
+	if !reflect.DeepEqual(described.Data.Spec, &want) {
+		t.Errorf("unexpected spec %+v", described.Data.Spec)
+	}
+	out := mustCloud(t, url, "job", "describe", id)
+	if !strings.Contains(out, "Args:      --lr '0.1 x'") || !strings.Contains(out, "Timeout:   1h0m0s") {
+		t.Errorf("unexpected describe output:\n%s", out)
+	}
+
+	// No spec flag leaves everything to the manager
+	id = strings.TrimSpace(mustCloud(t, url, "job", "launch", "plain", script, "-o", "id"))
+	out = mustCloud(t, url, "job", "describe", id, "-o", "json")
+	if strings.Contains(out, "spec") {
+		t.Errorf("unexpected spec in %s", out)
+	}
+
+	for _, args := range [][]string{
+		{"-e", "NOVALUE"},
+		{"--memory", "lots"},
+		{"--cpu", "-1"},
+	} {
+		res := cloud(t, url, "", append([]string{"job", "launch", "train", script}, args...)...)
+		if res.code != ExitUsage {
+			t.Errorf("%v: exit code %d, stderr: %s", args, res.code, res.stderr)
+		}
+	}
+}
+
+func TestJobDescribe(t *testing.T) {
+	manager, url := newManager(t)
+	manager.JobDuration = 20 * time.Millisecond
+
+	script := filepath.Join(t.TempDir(), "fail.sh")
+	err := os.WriteFile(script, []byte("exit 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "worker", "pod-1")
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "fail", script, "-o", "id"))
+	mustCloud(t, url, "job", "ls")
+	time.Sleep(2 * manager.JobDuration)
+
+	var described struct {
+		Data client.JobDetails `json:"data"`
+	}
+	err = json.Unmarshal([]byte(mustCloud(t, url, "job", "describe", id, "-o", "json")), &described)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := described.Data
+	var history []string
+	for _, transition := range job.History {
+		history = append(history, transition.Status)
+	}
+	switch {
+	case job.Status != "failed" || job.Pod != "default" || job.Filename != "fail.sh":
+		t.Errorf("unexpected job %+v", job)
+	case job.Submitted == nil || job.Started == nil || job.Ended == nil || job.Ended.Before(*job.Started):
+		t.Errorf("unexpected timestamps %v %v %v", job.Submitted, job.Started, job.Ended)
+	case job.ExitCode == nil || *job.ExitCode != 1:
+		t.Errorf("unexpected exit code %v", job.ExitCode)
+	case strings.Join(history, " ") != "registered running failed":
+		t.Errorf("unexpected history %v", history)
+	}
+	out := mustCloud(t, url, "job", "describe", id)
+	if !strings.Contains(out, "Exit code: 1") || !strings.Contains(out, "Sha256:    "+job.Sha256) {
+		t.Errorf("unexpected describe output:\n%s", out)
+	}
+
+	// A manager that cannot describe jobs still gives what the job list has
+	mux := http.NewServeMux()
+	mux.Handle("/", manager)
+	mux.Handle("/cloud/job/describe/", http.NotFoundHandler())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	res := cloud(t, server.URL, "", "job", "describe", id)
+	if res.code != ExitOK || !strings.Contains(res.stdout, "Pod:       default") || !strings.Contains(res.stdout, "Submitted: -") ||
+		!strings.Contains(res.stderr, "does not describe jobs") {
+		t.Errorf("exit code %d, stdout: %s, stderr: %s", res.code, res.stdout, res.stderr)
+	}
+	res = cloud(t, server.URL, "", "job", "describe", "job-missing")
+	if res.code != ExitRejected || !strings.Contains(res.stderr, "not listed") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestJobRerun(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "train.sh")
+	err := os.WriteFile(script, []byte("echo v1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "train", script, "-e", "A=1", "-o", "id", "--", "x"))
+
+	// The copy of the script is launched again, not the changed file
+	err = os.WriteFile(script, []byte("echo v2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rerun := strings.TrimSpace(mustCloud(t, url, "job", "rerun", id, "--name", "again", "-o", "id"))
+	if rerun == id || manager.Script(rerun) != "echo v1\n" {
+		t.Errorf("job %s reran %s with %q", id, rerun, manager.Script(rerun))
+	}
+
+	var listed cliResponse[[]history.Submission]
+	err = json.Unmarshal([]byte(mustCloud(t, url, "job", "history", "-o", "json")), &listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Data) != 2 {
+		t.Fatalf("unexpected history %+v", listed.Data)
+	}
+	last := listed.Data[1]
+	if last.Id != rerun || last.Name != "again" || last.RerunOf != id || last.Script != script ||
+		last.Spec == nil || last.Spec.Env["A"] != "1" || strings.Join(last.Spec.Args, " ") != "x" {
+		t.Errorf("unexpected submission %+v", last)
+	}
+	if out := mustCloud(t, url, "job", "history", "--limit", "1", "-o", "id"); out != rerun+"\n" {
+		t.Errorf("unexpected history %q", out)
+	}
+
+	// A bundle is collected again, unless its entrypoint changed
+	proj := filepath.Join(dir, "proj")
+	err = os.MkdirAll(proj, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(proj, "run.sh"), []byte("echo bundle\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = strings.TrimSpace(mustCloud(t, url, "job", "launch", "bundle", proj, "-o", "id"))
+	rerun = strings.TrimSpace(mustCloud(t, url, "job", "rerun", id, "-o", "id"))
+	if names, entrypoint := manager.Bundle(rerun); strings.Join(names, " ") != "run.sh" || entrypoint != "run.sh" {
+		t.Errorf("unexpected bundle %v, entrypoint %q", names, entrypoint)
+	}
+
+	// Nor is it if a file was added, or one of its files changed
+	err = os.WriteFile(filepath.Join(proj, "extra.py"), []byte("pass\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := cloud(t, url, "", "job", "rerun", id)
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "extra.py") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	id = strings.TrimSpace(mustCloud(t, url, "job", "launch", "files", filepath.Join(proj, "run.sh"), "--file", filepath.Join(proj, "extra.py"), "-o", "id"))
+	mustCloud(t, url, "job", "rerun", id)
+	err = os.WriteFile(filepath.Join(proj, "extra.py"), []byte("print()\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = cloud(t, url, "", "job", "rerun", id)
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "extra.py") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+
+	err = os.WriteFile(filepath.Join(proj, "run.sh"), []byte("echo changed\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = cloud(t, url, "", "job", "rerun", id)
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "changed since") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+
+	res = cloud(t, url, "", "job", "rerun", "job-unknown")
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "job history") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestWorkflow(t *testing.T) {
+	manager, url := newManager(t)
+	manager.JobDuration = 20 * time.Millisecond
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.sh":   "echo ok\n",
+		"fail.sh": "exit 1\n",
+		"flow.yaml": `name: flow
+jobs:
+  - name: broken
+    script: fail.sh
+  - name: first
+    script: ok.sh
+  - name: second
+    script: ok.sh
+    depends_on: [first]
+    args: [x]
+  - name: last
+    script: ok.sh
+    depends_on: [second, broken]
+`,
+		"cycle.yaml":   "jobs:\n  - {name: a, script: ok.sh, depends_on: [b]}\n  - {name: b, script: ok.sh, depends_on: [a]}\n",
+		"unknown.yaml": "jobs:\n  - {name: a, script: ok.sh, depends_on: [b]}\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	flow := filepath.Join(dir, "flow.yaml")
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "one", "pod-1")
+	mustCloud(t, url, "node", "register", "job", "two", "pod-1")
+
+	statuses := func(stdout string) map[string]string {
+		var response struct {
+			Data []workflowJob `json:"data"`
+		}
+		err := json.Unmarshal([]byte(stdout), &response)
+		if err != nil {
+			t.Fatalf("%v: %s", err, stdout)
+		}
+		result := map[string]string{}
+		for _, job := range response.Data {
+			result[job.Name] = job.Status
+		}
+		return result
+	}
+
+	// broken and first fail and complete together, halt launches nothing more
+	res := cloud(t, url, "", "workflow", "run", flow, "--poll-interval", "10ms", "-o", "json")
+	if res.code != ExitJobFailed {
+		t.Fatalf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	got := statuses(res.stdout)
+	if got["broken"] != "failed" || got["first"] != "completed" || got["second"] != "skipped" || got["last"] != "skipped" {
+		t.Errorf("unexpected statuses %v", got)
+	}
+
+	res = cloud(t, url, "", "workflow", "run", flow, "--poll-interval", "10ms", "-o", "json", "--on-failure", "continue")
+	got = statuses(res.stdout)
+	if res.code != ExitJobFailed || got["second"] != "completed" || got["last"] != "skipped" {
+		t.Errorf("exit code %d, statuses %v, stderr: %s", res.code, got, res.stderr)
+	}
+
+	for _, file := range []string{"cycle.yaml", "unknown.yaml"} {
+		res = cloud(t, url, "", "workflow", "run", filepath.Join(dir, file))
+		if res.code != ExitUsage {
+			t.Errorf("%s: exit code %d, stderr: %s", file, res.code, res.stderr)
+		}
+	}
+	out := mustCloud(t, url, "workflow", "run", flow, "--dry-run")
+	if !strings.Contains(out, "last     2       second, broken") {
+		t.Errorf("unexpected dry run:\n%s", out)
+	}
+}
+
+func TestWorkflowStopped(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	flow := filepath.Join(dir, "flow.yaml")
+	files := map[string]string{
+		"ok.sh":     "echo ok\n",
+		"flow.yaml": "jobs:\n  - {name: first, script: ok.sh}\n  - {name: second, script: ok.sh, depends_on: [first]}\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "one", "pod-1")
+
+	// Without JobDuration, first stays registered until --wait-timeout
+	res := cloud(t, url, "", "workflow", "run", flow, "--poll-interval", "10ms", "--wait-timeout", "100ms")
+	if res.code != ExitTimeout {
+		t.Fatalf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	for _, want := range []string{"first", "registered", "second", "pending"} {
+		if !strings.Contains(res.stdout, want) {
+			t.Errorf("the final state misses %q:\n%s", want, res.stdout)
+		}
+	}
+
+	// A manager that lost the jobs launched
+	lost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/cloud/job/" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"status": true, "msg": "jobs listed", "data": []}`)
+			return
+		}
+		manager.ServeHTTP(w, r)
+	}))
+	defer lost.Close()
+	res = cloud(t, lost.URL, "", "workflow", "run", flow, "--poll-interval", "10ms", "-o", "json")
+	if res.code != ExitRejected {
+		t.Fatalf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+	var response cliResponse[[]workflowJob]
+	err := json.Unmarshal([]byte(res.stdout), &response)
+	if err != nil {
+		t.Fatalf("%v: %s", err, res.stdout)
+	}
+	jobs := response.Data
+	if len(jobs) != 2 || jobs[0].Status != stepNotFound || !strings.Contains(jobs[0].Error, "not listed") || jobs[1].Status != stepSkipped {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
+
+func TestJobSchedule(t *testing.T) {
+	manager, url := newManager(t)
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "report.sh")
+	err := os.WriteFile(script, []byte("echo report\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"--cron", "61 * * * *"},
+		{"--cron", "* * *"},
+		{"--at", "2000-01-01T00:00:00Z"},
+		{"--at", "+1h", "--cron", "@daily"},
+		{},
+	} {
+		res := cloud(t, url, "", append([]string{"job", "schedule", "report", script}, args...)...)
+		if res.code != ExitUsage {
+			t.Errorf("%v: exit code %d, stderr: %s", args, res.code, res.stderr)
+		}
+	}
+
+	cron := strings.TrimSpace(mustCloud(t, url, "job", "schedule", "every", script, "--cron", "*/5 * * * *", "-o", "id"))
+	once := strings.TrimSpace(mustCloud(t, url, "job", "schedule", "once", script, "--at", "+1s", "-e", "A=1", "-o", "id", "--", "x"))
+
+	// The script is kept as it was scheduled
+	err = os.WriteFile(script, []byte("echo changed\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed cliResponse[[]*schedule.Entry]
+	err = json.Unmarshal([]byte(mustCloud(t, url, "schedule", "ls", "-o", "json")), &listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Data) != 2 || listed.Data[0].Id != cron || listed.Data[1].Id != once {
+		t.Fatalf("unexpected schedules %+v", listed.Data)
+	}
+	if next := listed.Data[0].Next; next == nil || next.Minute()%5 != 0 || next.Second() != 0 || !next.After(time.Now()) {
+		t.Errorf("unexpected next time %v for */5", next)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	mustCloud(t, url, "scheduler", "run", "--once")
+
+	listed = cliResponse[[]*schedule.Entry]{}
+	err = json.Unmarshal([]byte(mustCloud(t, url, "schedule", "ls", "-o", "json")), &listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := listed.Data[1]
+	if len(entry.Runs) != 1 || entry.Runs[0].Id == "" || entry.Runs[0].Error != "" || entry.Next != nil {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	id := entry.Runs[0].Id
+	if manager.Script(id) != "echo report\n" {
+		t.Errorf("unexpected script %q", manager.Script(id))
+	}
+	if len(listed.Data[0].Runs) != 0 {
+		t.Errorf("job not due launched: %+v", listed.Data[0].Runs)
+	}
+	if out := mustCloud(t, url, "job", "history", "-o", "id"); out != id+"\n" {
+		t.Errorf("unexpected history %q", out)
+	}
+
+	// A job launched once is not launched again
+	mustCloud(t, url, "scheduler", "run", "--once")
+	if out := mustCloud(t, url, "job", "history", "-o", "id"); out != id+"\n" {
+		t.Errorf("unexpected history %q", out)
+	}
+
+	mustCloud(t, url, "schedule", "rm", once)
+	if out := mustCloud(t, url, "schedule", "ls", "-o", "id"); out != cron+"\n" {
+		t.Errorf("unexpected schedules %q", out)
+	}
+	if res := cloud(t, url, "", "schedule", "rm", once); res.code != ExitUsage {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+
+	// Jobs may be named after the commands of the scheduler
+	mustCloud(t, url, "job", "schedule", "ls", script, "--at", "+1h")
+
+	// A launch the manager was too busy for is tried again later, up to 5
+	// times, one that cannot have worked is not
+	busyLeft := 0
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/cloud/job/" && busyLeft > 0 {
+			busyLeft--
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		manager.ServeHTTP(w, r)
+	}))
+	defer busy.Close()
+	store := schedule.Open(filepath.Join(filepath.Dir(os.Getenv("CLOUD_CONFIG")), "schedule"))
+	runOnce := func(id string) *schedule.Entry {
+		t.Helper()
+		now := time.Now()
+		err := store.Update(func(f *schedule.File) error {
+			f.Find(id).Next = &now
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cloud(t, busy.URL, "", "schedule", "run", "--once")
+		f, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f.Find(id)
+	}
+
+	flaky := strings.TrimSpace(mustCloud(t, busy.URL, "job", "schedule", "flaky", script, "--at", "+1h", "-o", "id"))
+	busyLeft = 1
+	if entry := runOnce(flaky); len(entry.Runs) != 1 || entry.Runs[0].Error == "" || entry.Next == nil || !entry.Next.After(time.Now()) {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if entry := runOnce(flaky); len(entry.Runs) != 2 || entry.Runs[1].Id == "" || entry.Next != nil {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	down := strings.TrimSpace(mustCloud(t, busy.URL, "job", "schedule", "down", script, "--at", "+1h", "-o", "id"))
+	busyLeft = 10
+	var last *schedule.Entry
+	for i := 0; i < 5; i++ {
+		last = runOnce(down)
+	}
+	if len(last.Runs) != 5 || last.Runs[4].Error == "" || last.Next != nil {
+		t.Fatalf("unexpected entry %+v", last)
+	}
+
+	lost := filepath.Join(dir, "lost.sh")
+	err = os.WriteFile(lost, []byte("echo lost\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := strings.TrimSpace(mustCloud(t, busy.URL, "job", "schedule", "gone", lost, "--at", "+1h", "-o", "id"))
+	f, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(filepath.Dir(os.Getenv("CLOUD_CONFIG")), "history", "scripts", f.Find(gone).Sha256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := runOnce(gone); len(entry.Runs) != 1 || !strings.Contains(entry.Runs[0].Error, "no longer kept") || entry.Next != nil {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	t.Setenv("CLOUD_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+	if res := cloud(t, "", "", "job", "schedule", "report", script, "--at", "+1h"); res.code != ExitUsage || !strings.Contains(res.stderr, "manager") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestLaunchWait(t *testing.T) {
+	manager, url := newManager(t)
+	manager.JobDuration = 20 * time.Millisecond
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.sh")
+	bad := filepath.Join(dir, "bad.sh")
+	for path, script := range map[string]string{good: "echo good\n", bad: "exit 1\n"} {
+		err := os.WriteFile(path, []byte(script), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "worker", "pod-1")
+
+	res := cloud(t, url, "", "job", "launch", "good", good, "--wait", "--poll-interval", "10ms")
+	if res.code != ExitOK || !strings.Contains(res.stdout, "+ echo good") {
+		t.Errorf("exit code %d, log not printed: %q", res.code, res.stdout)
+	}
+	res = cloud(t, url, "", "job", "launch", "bad", bad, "--wait", "--poll-interval", "10ms")
+	if res.code != ExitJobFailed {
+		t.Errorf("failed job: exit code %d", res.code)
+	}
+
+	// Without a free node the job never starts
+	mustCloud(t, url, "node", "rm", "node-2")
+	res = cloud(t, url, "", "job", "launch", "stuck", good, "--wait", "--poll-interval", "10ms", "--wait-timeout", "50ms")
+	if res.code != ExitTimeout || !strings.Contains(res.stderr, "registered") {
+		t.Errorf("exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestJobLogFollow(t *testing.T) {
+	manager, url := newManager(t)
+	manager.JobDuration = 30 * time.Millisecond
+
+	script := filepath.Join(t.TempDir(), "steps.sh")
+	err := os.WriteFile(script, []byte("echo one\necho two\necho three\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "worker", "pod-1")
+	id := strings.TrimSpace(mustCloud(t, url, "job", "launch", "steps", script, "-o", "id"))
+
+	out := mustCloud(t, url, "job", "log", id, "-f", "--poll-interval", "5ms")
+	for _, line := range []string{"+ echo one", "+ echo two", "+ echo three", "completed"} {
+		if strings.Count(out, line) != 1 {
+			t.Errorf("%q not printed once: %q", line, out)
+		}
+	}
+
+	out = mustCloud(t, url, "job", "log", id, "-f", "--tail", "2")
+	if out != "+ echo three\njob "+id+" completed\n" {
+		t.Errorf("unexpected tail: %q", out)
+	}
+
+	res := cloud(t, url, "", "job", "log", id, "-f", "-o", "json")
+	if res.code != ExitUsage {
+		t.Errorf("follow with json: exit code %d", res.code)
+	}
+}
+
+func TestPodLogs(t *testing.T) {
+	_, url := newManager(t)
+
+	mustCloud(t, url, "init")
+	mustCloud(t, url, "node", "register", "job", "a", "pod-1")
+	mustCloud(t, url, "node", "register", "job", "bb", "pod-1")
+
+	out := mustCloud(t, url, "pod", "logs", "pod-1")
+	want := "a  | node node-2 registered in pod pod-1\nbb | node node-3 registered in pod pod-1\n"
+	if out != want {
+		t.Errorf("unexpected logs: %q", out)
+	}
+
+	res := cloud(t, url, "", "pod", "logs", "pod-1", "-o", "json")
+	if res.code != ExitUsage {
+		t.Errorf("pod logs with json: exit code %d", res.code)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	var out bytes.Buffer
+	f := &follower{w: &out, prefix: "> ", tail: 1}
+
+	f.feed("a\nb\nc")
+	f.feed("a\nb\nc\nd\n")
+	if out.String() != "> c\n> d\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	// A log that shrank was replaced
+	out.Reset()
+	f.feed("e")
+	f.flush()
+	if out.String() != "> e\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestServer(t *testing.T) {
+	_, url := newManager(t)
+	mustCloud(t, url, "pod", "register", "server", "web")
+	mustCloud(t, url, "node", "register", "server", "web-1", "pod-1")
+
+	for _, action := range []string{"launch", "pause", "resume"} {
+		out := mustCloud(t, url, "server", action, "pod-1", "-o", "id")
+		if out != "node-2\n" {
+			t.Errorf("server %s: unexpected output %q", action, out)
+		}
+	}
+
+	out := mustCloud(t, url, "node", "ls", "-o", "json")
+	if !strings.Contains(out, `"node_status": "online"`) {
+		t.Errorf("server not online after resume: %q", out)
+	}
+}
+
+func TestElasticity(t *testing.T) {
+	_, url := newManager(t)
+	mustCloud(t, url, "init")
+
+	mustCloud(t, url, "elasticity", "lower_threshold", "pod-1", "0.2")
+	mustCloud(t, url, "elasticity", "upper_threshold", "pod-1", "0.8")
+	mustCloud(t, url, "elasticity", "enable", "pod-1", "1", "3")
+	out := mustCloud(t, url, "pod", "ls", "-o", "json")
+	if !strings.Contains(out, `"is_elastic": true`) {
+		t.Errorf("elasticity not enabled: %q", out)
+	}
+	mustCloud(t, url, "elasticity", "disable", "pod-1")
+
+	res := cloud(t, url, "", "elasticity", "enable", "pod-1", "one", "3")
+	if res.code != ExitUsage {
+		t.Errorf("invalid min_node: exit code %d", res.code)
+	}
+	res = cloud(t, url, "", "elasticity", "enable", "pod-1", "3", "1")
+	if res.code != ExitRejected {
+		t.Errorf("min_node above max_node: exit code %d", res.code)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	_, url := newManager(t)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cloud/pod/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>maintenance</html>"))
+		case "/cloud/node/":
+			w.Write([]byte("{not json"))
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(broken.Close)
+
+	tests := []struct {
+		name string
+		url  string
+		args []string
+		code int
+	}{
+		{"success", url, []string{"pod", "ls"}, ExitOK},
+		{"missing argument", url, []string{"pod", "rm"}, ExitUsage},
+		{"unknown flag", url, []string{"pod", "ls", "--nope"}, ExitUsage},
+		{"bad flag value", url, []string{"pod", "ls", "--timeout", "soon"}, ExitUsage},
+		{"unknown command", url, []string{"nope"}, ExitUsage},
+		{"unknown output", url, []string{"pod", "ls", "-o", "xml"}, ExitUsage},
+		{"no manager", "", []string{"pod", "ls"}, ExitUsage},
+		{"unreachable", closed.URL, []string{"pod", "ls", "--max-attempts", "1"}, ExitUnreachable},
+		{"rejected", url, []string{"pod", "rm", "nope"}, ExitRejected},
+		{"wrong path", url + "/nope", []string{"pod", "ls"}, ExitRejected},
+		{"html", broken.URL, []string{"pod", "ls"}, ExitMalformed},
+		{"invalid json", broken.URL, []string{"node", "ls"}, ExitMalformed},
+		{"server error", broken.URL, []string{"job", "ls", "--max-attempts", "1"}, ExitServer},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := cloud(t, test.url, "", test.args...)
+			if res.code != test.code {
+				t.Errorf("exit code %d, expected %d, stderr: %s", res.code, test.code, res.stderr)
+			}
+			if res.code != ExitOK && !strings.HasPrefix(res.stderr, "Error: ") {
+				t.Errorf("no error message on stderr: %q", res.stderr)
+			}
+		})
+	}
+
+	// Local failures are not usage errors
+	if code := exitCode(fmt.Errorf("could not save: %w", fs.ErrPermission)); code != ExitError {
+		t.Errorf("exit code %d for a local failure", code)
+	}
+	if msg := (&client.Error{}).Error(); msg == "" {
+		t.Error("empty message for a client error without cause")
+	}
+
+	// A config file that cannot be written
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	err := os.Symlink(filepath.Join(dir, "missing", "config.yaml"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLOUD_CONFIG", config)
+	res := cloud(t, "", "", "config", "set-context", "foo", "--manager", "http://x")
+	if res.code != ExitError {
+		t.Errorf("unwritable config: exit code %d, stderr: %s", res.code, res.stderr)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	manager, url := newManager(t)
+	manager.Token = "secret"
+	manager.Users = map[string]string{"bob": "hunter2"}
+
+	res := cloud(t, url, "", "pod", "ls")
+	if res.code != ExitAuth || !strings.Contains(res.stderr, "cloud login") {
+		t.Errorf("not logged in: exit code %d, stderr %q", res.code, res.stderr)
+	}
+
+	res = cloud(t, url, "bob\nwrong\n", "login")
+	if res.code != ExitAuth {
+		t.Errorf("wrong password: exit code %d", res.code)
+	}
+
+	res = cloud(t, url, "bob\nhunter2\n", "login")
+	if res.code != ExitOK {
+		t.Fatalf("login: exit code %d, stderr %q", res.code, res.stderr)
+	}
+
+	// The token now lives in the default context, which also knows the manager
+	mustCloud(t, "", "pod", "ls")
+	mustCloud(t, "", "logout")
+	res = cloud(t, "", "", "pod", "ls")
+	if res.code != ExitAuth {
+		t.Errorf("logged out: exit code %d", res.code)
+	}
+
+	// The token of the context is not sent to another manager
+	var auth []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": true, "msg": "pods listed", "data": []}`)
+	}))
+	defer other.Close()
+	mustCloud(t, "", "login", "--token", "secret")
+	mustCloud(t, other.URL, "pod", "ls")
+	if len(auth) != 1 || auth[0] != "" {
+		t.Errorf("unexpected Authorization headers %q", auth)
+	}
+
+	// Logging in to another manager needs a context for it
+	res = cloud(t, other.URL, "", "login", "--token", "other")
+	if res.code != ExitUsage || !strings.Contains(res.stderr, "set-context") {
+		t.Errorf("exit code %d, stderr %q", res.code, res.stderr)
+	}
+	mustCloud(t, "", "config", "set-context", "other", "--manager", other.URL)
+	out := mustCloud(t, other.URL, "login", "--token", "other")
+	if !strings.Contains(out, `"other"`) {
+		t.Errorf("unexpected output %q", out)
+	}
+	mustCloud(t, "", "pod", "ls", "--context", "other")
+	mustCloud(t, "", "pod", "ls")
+	if len(auth) != 2 || auth[1] != "Bearer other" {
+		t.Errorf("unexpected Authorization headers %q", auth)
+	}
+}
+
+func TestConfigContexts(t *testing.T) {
+	_, dev := newManager(t)
+	_, prod := newManager(t)
+	mustCloud(t, prod, "pod", "register", "job", "prod")
+
+	mustCloud(t, "", "config", "set-context", "dev", "--manager", dev)
+	mustCloud(t, "", "config", "set-context", "prod", "--manager", prod, "--output", "id")
+
+	out := mustCloud(t, "", "config", "get-contexts")
+	if !strings.Contains(out, "*") || !strings.Contains(out, "dev") || !strings.Contains(out, "prod") {
+		t.Errorf("unexpected contexts: %q", out)
+	}
+
+	// dev is current, it has no pods
+	res := cloud(t, "", "", "pod", "ls")
+	if res.code != ExitOK || res.stdout != "" {
+		t.Errorf("dev context: %+v", res)
+	}
+
+	out = mustCloud(t, "", "pod", "ls", "--context", "prod")
+	if out != "pod-1\n" {
+		t.Errorf("prod context should list pod ids: %q", out)
+	}
+
+	mustCloud(t, "", "config", "use-context", "prod")
+	out = mustCloud(t, "", "pod", "ls", "-o", "table")
+	if !strings.Contains(out, "prod") {
+		t.Errorf("flags should win over the context: %q", out)
+	}
+
+	res = cloud(t, "", "", "config", "use-context", "nope")
+	if res.code != ExitUsage {
+		t.Errorf("unknown context: exit code %d", res.code)
+	}
+
+	// The token is never printed, only whether there is one
+	mustCloud(t, "", "login", "--token", "s3cret")
+	for _, format := range []string{"table", "json", "yaml", "id"} {
+		out := mustCloud(t, "", "config", "get-contexts", "-o", format)
+		if strings.Contains(out, "s3cret") {
+			t.Errorf("token printed with -o %s: %q", format, out)
+		}
+	}
+	var view contextsView
+	err := json.Unmarshal([]byte(mustCloud(t, "", "config", "get-contexts", "-o", "json")), &view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Contexts["prod"] == nil || !view.Contexts["prod"].LoggedIn || view.Contexts["dev"].LoggedIn {
+		t.Errorf("unexpected contexts %+v", view.Contexts)
+	}
+}
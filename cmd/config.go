@@ -0,0 +1,360 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/config"
+
+	"github.com/spf13/cobra"
+)
+
+// Persistent flags selecting the manager to talk to.
+var (
+	cfgFile     string
+	contextName string
+	managerFlag string
+
+	caCertFlag     string
+	clientCertFlag string
+	clientKeyFlag  string
+	insecureFlag   bool
+)
+
+// Settings resolved by loadSettings on top of ManagerEp and Client.
+var (
+	// currentContext is the name of the context in use, empty if none
+	currentContext string
+	// token is sent as a bearer token with every request
+	token string
+)
+
+// Flags of set-context.
+var (
+	setContextManager    string
+	setContextOutput     string
+	setContextCACert     string
+	setContextClientCert string
+	setContextClientKey  string
+	setContextInsecure   bool
+)
+
+// configPath returns the path of the configuration file, from --config,
+// CLOUD_CONFIG or the user config directory.
+func configPath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	if path := os.Getenv("CLOUD_CONFIG"); path != "" {
+		return path, nil
+	}
+	path, err := config.DefaultPath()
+	if err != nil {
+		return "", badInputf("could not locate the config file: %v", err)
+	}
+	return path, nil
+}
+
+// loadConfig reads the configuration file.
+func loadConfig() (*config.Config, string, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	conf, err := config.Load(path)
+	if err != nil {
+		return nil, "", badInput(err)
+	}
+	return conf, path, nil
+}
+
+// loadSettings resolves the manager endpoint and the defaults of cmd. Every
+// setting is taken from the first place it is set in: flags, environment
+// variables, the .env file and finally the selected context of the config
+// file. Execute loads .env into the environment without overriding it, so the
+// environment takes care of the .env step.
+func loadSettings(cmd *cobra.Command) error {
+	conf, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	name := contextName
+	if name == "" {
+		name = os.Getenv("CLOUD_CONTEXT")
+	}
+	if name == "" {
+		name = conf.CurrentContext
+	}
+	context := conf.Context(name)
+	if context == nil {
+		if name != "" && name != conf.CurrentContext {
+			return badInputf("no context named %q in %s", name, path)
+		}
+		name = ""
+		context = &config.Context{}
+	}
+	currentContext = name
+
+	switch {
+	case managerFlag != "":
+		ManagerEp = managerFlag
+	case os.Getenv("MANAGER") != "":
+		ManagerEp = os.Getenv("MANAGER")
+	default:
+		ManagerEp = context.Manager
+	}
+
+	if !cmd.Flags().Changed("output") && context.Output != "" {
+		outputFormat = context.Output
+	}
+
+	// The token of the context is only sent to its own manager
+	token = os.Getenv("CLOUD_TOKEN")
+	if token == "" && sameManager(ManagerEp, context.Manager) {
+		token = context.Token
+	}
+
+	opts := client.TLSOptions{
+		CACert:             context.CACert,
+		ClientCert:         context.ClientCert,
+		ClientKey:          context.ClientKey,
+		InsecureSkipVerify: context.InsecureSkipTLSVerify,
+	}
+	if caCertFlag != "" {
+		opts.CACert = caCertFlag
+	}
+	if clientCertFlag != "" || clientKeyFlag != "" {
+		opts.ClientCert = clientCertFlag
+		opts.ClientKey = clientKeyFlag
+	}
+	if cmd.Flags().Changed("insecure-skip-tls-verify") {
+		opts.InsecureSkipVerify = insecureFlag
+	}
+	Client, err = client.NewHTTPClient(opts)
+	if err != nil {
+		return badInput(err)
+	}
+	return nil
+}
+
+// sameManager reports whether a and b are the same manager endpoint.
+func sameManager(a, b string) bool {
+	return a != "" && strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// absPath makes a file stored in a context usable from any directory.
+func absPath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", badInput(err)
+	}
+	return path, nil
+}
+
+// contextsView is the config as printed by get-contexts.
+type contextsView struct {
+	CurrentContext string                  `json:"current-context,omitempty" yaml:"current-context,omitempty"`
+	Contexts       map[string]*contextView `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+}
+
+// contextView is a context without its token, which must not end up on a
+// screen or in a log, only whether there is one.
+type contextView struct {
+	config.Context `yaml:",inline"`
+	LoggedIn       bool `json:"logged-in" yaml:"logged-in"`
+}
+
+// redactConfig returns the view of conf printed by get-contexts.
+func redactConfig(conf *config.Config) *contextsView {
+	view := &contextsView{CurrentContext: conf.CurrentContext, Contexts: map[string]*contextView{}}
+	for name, context := range conf.Contexts {
+		redacted := &contextView{Context: *context, LoggedIn: context.Token != ""}
+		redacted.Token = ""
+		view.Contexts[name] = redacted
+	}
+	return view
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "All commands related to the config file and its contexts",
+	// The config commands must work without a manager and with a broken
+	// context, so they skip loadSettings
+	PersistentPreRunE: checkOutputFormat,
+}
+
+var configGetContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List all contexts, the current one is marked with a *",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, _, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Print the contexts
+		names := conf.Names()
+		view := redactConfig(conf)
+		return printResponse(cmd, view, names, func(w io.Writer) {
+			if len(names) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No contexts found")
+				return
+			}
+
+			t := newTable("CURRENT", "NAME", "MANAGER", "OUTPUT", "LOGGED IN")
+			for _, name := range names {
+				current := ""
+				if name == conf.CurrentContext {
+					current = "*"
+				}
+				context := view.Contexts[name]
+				t.addRow(current, name, context.Manager, context.Output,
+					strconv.FormatBool(context.LoggedIn))
+			}
+			t.render(w)
+		})
+	},
+}
+
+var configUseContextCmd = &cobra.Command{
+	Use:   "use-context [name]",
+	Short: "Set the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if conf.Contexts[args[0]] == nil {
+			return badInputf("no context named %q in %s", args[0], path)
+		}
+
+		conf.CurrentContext = args[0]
+		err = conf.Save(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Switched to context %q\n", args[0])
+		return nil
+	},
+}
+
+var configSetContextCmd = &cobra.Command{
+	Use:   "set-context [name]",
+	Short: "Create a context or update the given fields of an existing one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		context := conf.Contexts[args[0]]
+		if context == nil {
+			context = &config.Context{}
+		}
+		if cmd.Flags().Changed("manager") {
+			context.Manager = setContextManager
+		}
+		if cmd.Flags().Changed("ca-cert") {
+			context.CACert, err = absPath(setContextCACert)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("client-cert") {
+			context.ClientCert, err = absPath(setContextClientCert)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("client-key") {
+			context.ClientKey, err = absPath(setContextClientKey)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("insecure-skip-tls-verify") {
+			context.InsecureSkipTLSVerify = setContextInsecure
+		}
+		if cmd.Flags().Changed("output") {
+			err = validOutputFormat(setContextOutput)
+			if err != nil {
+				return err
+			}
+			context.Output = setContextOutput
+		}
+		conf.SetContext(args[0], context)
+
+		// The first context becomes the current one
+		if conf.CurrentContext == "" {
+			conf.CurrentContext = args[0]
+		}
+
+		err = conf.Save(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Context %q saved in %s\n", args[0], path)
+		return nil
+	},
+}
+
+var configDeleteContextCmd = &cobra.Command{
+	Use:   "delete-context [name]",
+	Short: "Delete a context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if conf.Contexts[args[0]] == nil {
+			return badInputf("no context named %q in %s", args[0], path)
+		}
+
+		delete(conf.Contexts, args[0])
+		if conf.CurrentContext == args[0] {
+			conf.CurrentContext = ""
+		}
+		err = conf.Save(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Deleted context %q\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetContextsCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configCmd.AddCommand(configSetContextCmd)
+	configCmd.AddCommand(configDeleteContextCmd)
+
+	// These shadow the persistent flags of the same name: here they are the
+	// values stored in the context
+	configSetContextCmd.Flags().StringVar(&setContextManager, "manager", "", "url of the manager, e.g. https://10.140.17.117")
+	configSetContextCmd.Flags().StringVar(&setContextOutput, "output", "", "default output format of the commands")
+	configSetContextCmd.Flags().StringVar(&setContextCACert, "ca-cert", "", "PEM bundle of the CA that signed the manager's certificate")
+	configSetContextCmd.Flags().StringVar(&setContextClientCert, "client-cert", "", "PEM client certificate for mutual TLS")
+	configSetContextCmd.Flags().StringVar(&setContextClientKey, "client-key", "", "PEM client key for mutual TLS")
+	configSetContextCmd.Flags().BoolVar(&setContextInsecure, "insecure-skip-tls-verify", false, "don't verify the manager's certificate, this is insecure")
+}
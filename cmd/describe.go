@@ -0,0 +1,148 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// unknown is shown for the details the manager does not provide.
+const unknown = "-"
+
+// jobRunning is the status of a job while its node runs it.
+const jobRunning = "running"
+
+var jobDescribeCmd = &cobra.Command{
+	Use:   "describe [job_id]",
+	Short: "Show the details of a job",
+	Long: `Show the details of a job: when it was submitted, started and ended, where
+it ran, its exit code, its script and the history of its status, along with
+what it was launched with, the arguments and environment of its script and the
+resources it asked for.
+
+Details the manager does not provide are shown as "-". Managers that cannot
+describe jobs only give the name, status and node of the job.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Send the request
+		response, err := manager().DescribeJob(cmd.Context(), args[0])
+		if client.KindOf(err) == client.KindNotFound {
+			// The manager has no describe endpoint, fall back to the job list
+			var job *client.Job
+			job, err = findJob(cmd.Context(), cmd, args[0])
+			if err == nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "The manager does not describe jobs, only some details are shown")
+				response = &client.JobDescribeResponse{
+					Response: client.Response{Status: true, Msg: "job " + job.Id + " listed"},
+					Data:     client.JobDetails{Job: *job},
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		job := &response.Data
+		completeDetails(cmd.Context(), job)
+
+		// Print the response
+		return printResponse(cmd, response, []string{job.Id}, func(w io.Writer) {
+			exitCode := unknown
+			if job.ExitCode != nil {
+				exitCode = strconv.Itoa(*job.ExitCode)
+			}
+			lines := [][2]string{
+				{"Name", job.Name},
+				{"Id", job.Id},
+				{"Status", job.Status},
+				{"Pod", orUnknown(job.Pod)},
+				{"Node", orUnknown(job.Node)},
+				{"Submitted", formatTime(job.Submitted)},
+				{"Started", formatTime(job.Started)},
+				{"Ended", formatTime(job.Ended)},
+				{"Duration", jobDuration(job)},
+				{"Exit code", exitCode},
+				{"Script", orUnknown(job.Filename)},
+				{"Sha256", orUnknown(job.Sha256)},
+			}
+			lines = append(lines, specLines(job.Spec)...)
+			for i, transition := range job.History {
+				label := ""
+				if i == 0 {
+					label = "History"
+				}
+				lines = append(lines, [2]string{label, formatTime(&transition.Time) + " " + transition.Status})
+			}
+			printFields(w, lines)
+		})
+	},
+}
+
+// completeDetails fills in the details of job the manager left out but that
+// can be told from the others: the start and end from the history and the
+// pod from the node.
+func completeDetails(ctx context.Context, job *client.JobDetails) {
+	for i := range job.History {
+		transition := &job.History[i]
+		switch {
+		case transition.Status == jobRunning && job.Started == nil:
+			job.Started = &transition.Time
+		case finished(transition.Status) && job.Ended == nil:
+			job.Ended = &transition.Time
+		}
+	}
+
+	if job.Pod != "" || job.Node == "" {
+		return
+	}
+	response, err := manager().ListNodes(ctx, "")
+	if err != nil {
+		return
+	}
+	for _, node := range response.Data {
+		if node.Id == job.Node {
+			job.Pod = node.Pod.Name
+		}
+	}
+}
+
+// jobDuration returns how long job ran, or has been running so far.
+func jobDuration(job *client.JobDetails) string {
+	switch {
+	case job.Started == nil:
+		return unknown
+	case job.Ended != nil:
+		return job.Ended.Sub(*job.Started).Round(time.Second).String()
+	case job.Status == jobRunning:
+		return time.Since(*job.Started).Round(time.Second).String() + " so far"
+	default:
+		return unknown
+	}
+}
+
+// formatTime returns t in the local time zone, or unknown if nil.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return unknown
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return unknown
+	}
+	return value
+}
+
+func init() {
+	jobCmd.AddCommand(jobDescribeCmd)
+}
@@ -4,28 +4,13 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
 
-var elasticityEp string = "/cloud/elasticity/"
-
-type elasticitySetThresholdResp struct {
-	Status bool `json:"status"`
-}
-
-type elasticityEnableResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
-type elasticityDisableResp struct {
-	Status bool `json:"status"`
-}
-
 var elasticityCmd = &cobra.Command{
 	Use:   "elasticity",
 	Short: "All commands related to elasticity",
@@ -35,38 +20,22 @@ var elasticitySetLowerThresholdCmd = &cobra.Command{
 	Use:   "lower_threshold [pod_id] [value]",
 	Short: "Set a lower elastic threshold for a given resource pod.",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+elasticityEp+"lower/", nil)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := strconv.ParseFloat(args[1], 64)
 		if err != nil {
-			panic(err)
+			return badInputf("invalid threshold %q, expected a number", args[1])
 		}
 
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		params.Add("lower_threshold", args[1])
-		req.URL.RawQuery = params.Encode()
-
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().SetLowerThreshold(cmd.Context(), args[0], value)
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response elasticitySetThresholdResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success!")
-		} else {
-			fmt.Print("Failed!")
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprintln(w, "Success!")
+		})
 	},
 }
 
@@ -74,38 +43,22 @@ var elasticitySetUpperThresholdCmd = &cobra.Command{
 	Use:   "upper_threshold [pod_id] [value]",
 	Short: "Set a upper elastic threshold for a given resource pod.",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+elasticityEp+"upper/", nil)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := strconv.ParseFloat(args[1], 64)
 		if err != nil {
-			panic(err)
+			return badInputf("invalid threshold %q, expected a number", args[1])
 		}
 
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		params.Add("upper_threshold", args[1])
-		req.URL.RawQuery = params.Encode()
-
 		// Send the request
-		res, err := Client.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response elasticitySetThresholdResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		response, err := manager().SetUpperThreshold(cmd.Context(), args[0], value)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success!")
-		} else {
-			fmt.Print("Failed!")
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprintln(w, "Success!")
+		})
 	},
 }
 
@@ -113,40 +66,26 @@ var elasticityEnableCmd = &cobra.Command{
 	Use:   "enable [pod_id] [min_node] [max_node]",
 	Short: "Enable elasticity for a given pod, also need to specifiy the min and max amount of node in elastic mode",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+elasticityEp+"enable/", nil)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		minNode, err := strconv.Atoi(args[1])
 		if err != nil {
-			panic(err)
+			return badInputf("invalid min_node %q, expected an integer", args[1])
 		}
-
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		params.Add("min_node", args[1])
-		params.Add("max_node", args[2])
-		req.URL.RawQuery = params.Encode()
-
-		// Send the request
-		res, err := Client.Do(req)
+		maxNode, err := strconv.Atoi(args[2])
 		if err != nil {
-			panic(err)
+			return badInputf("invalid max_node %q, expected an integer", args[2])
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response elasticityEnableResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		// Send the request
+		response, err := manager().EnableElasticity(cmd.Context(), args[0], minNode, maxNode)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success!")
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprintln(w, "Success!")
+		})
 	},
 }
 
@@ -154,37 +93,17 @@ var elasticityDisableCmd = &cobra.Command{
 	Use:   "disable [pod_id]",
 	Short: "Disable elasticity for a given pod",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+elasticityEp+"disable/", nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().DisableElasticity(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response elasticityDisableResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success!")
-		} else {
-			fmt.Print("Failed!")
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprintln(w, "Success!")
+		})
 	},
 }
 
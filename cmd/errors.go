@@ -0,0 +1,195 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes returned by the cli, one per category of error.
+const (
+	ExitOK          = 0  // the command succeeded
+	ExitError       = 1  // an unexpected error, e.g. a local file that could not be written
+	ExitUsage       = 2  // bad arguments, flags or local input such as files
+	ExitUnreachable = 3  // the manager could not be reached
+	ExitRejected    = 4  // the manager refused the request: status=false, 404, 409...
+	ExitMalformed   = 5  // the manager answered with something we could not decode
+	ExitTLS         = 6  // the manager's certificate could not be verified
+	ExitAuth        = 7  // not logged in, the token expired or it is not allowed to do this
+	ExitTimeout     = 8  // the manager did not answer in time
+	ExitServer      = 9  // the manager, or a proxy in front of it, failed with a 5xx status
+	ExitJobFailed   = 10 // the job we waited for failed
+	ExitJobAborted  = 11 // the job we waited for was aborted
+
+	ExitInterrupted = 130 // interrupted with Ctrl-C, as a shell would report it
+)
+
+// errInterrupted is returned by a prompt stopped with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// usageError is an error raised by cobra itself, e.g. a wrong number of
+// arguments, an unknown flag or an unknown command.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// markUsageErrors makes the errors cobra raises on cmd and its subcommands
+// usage errors: those of the flags and of the positional arguments.
+func markUsageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			err := args(cmd, a)
+			if err != nil {
+				return &usageError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, child := range cmd.Commands() {
+		markUsageErrors(child)
+	}
+}
+
+// inputError is a problem with what the user gave us rather than with the
+// manager, e.g. a script that cannot be opened or a value that is not a number.
+type inputError struct {
+	err error
+}
+
+func (e *inputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *inputError) Unwrap() error {
+	return e.err
+}
+
+// badInput marks err as caused by local input.
+func badInput(err error) error {
+	return &inputError{err: err}
+}
+
+// badInputf is badInput with a formatted message.
+func badInputf(format string, a ...any) error {
+	return badInput(fmt.Errorf(format, a...))
+}
+
+// jobError reports a job we waited for that ended without completing.
+type jobError struct {
+	id     string
+	status string
+}
+
+func (e *jobError) Error() string {
+	return fmt.Sprintf("job %s %s", e.id, e.status)
+}
+
+// waitError reports that we stopped waiting for a job that is not over, either
+// because --wait-timeout elapsed or because of Ctrl-C.
+type waitError struct {
+	id          string
+	status      string
+	after       time.Duration
+	interrupted bool
+	// workflow is set when we waited for the jobs of a workflow, id is then
+	// one of those not over and status tells which
+	workflow string
+}
+
+func (e *waitError) Error() string {
+	reason := "gave up"
+	if e.interrupted {
+		reason = "stopped"
+	}
+	if e.workflow != "" {
+		return fmt.Sprintf("%s waiting for workflow %s after %s, %s", reason, e.workflow, e.after.Round(time.Second), e.status)
+	}
+	status := e.status
+	if status == "" {
+		status = "unknown"
+	}
+	return fmt.Sprintf("%s waiting for job %s after %s, its status is %s", reason, e.id, e.after.Round(time.Second), status)
+}
+
+// mayHaveApplied reports whether err interrupted a request that the manager
+// may have applied anyway.
+func mayHaveApplied(err error) bool {
+	var clientErr *client.Error
+	return errors.As(err, &clientErr) && clientErr.MayHaveApplied
+}
+
+// exitCode maps err to the exit code of its category. Errors of no known
+// category, e.g. a local file that could not be written, are unexpected
+// errors.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	if errors.Is(err, errInterrupted) {
+		return ExitInterrupted
+	}
+	var usage *usageError
+	var input *inputError
+	if errors.As(err, &usage) || errors.As(err, &input) || errors.Is(err, client.ErrNoEndpoint) || errors.Is(err, client.ErrNoScript) {
+		return ExitUsage
+	}
+
+	var job *jobError
+	if errors.As(err, &job) {
+		if job.status == jobAborted {
+			return ExitJobAborted
+		}
+		return ExitJobFailed
+	}
+	var wait *waitError
+	if errors.As(err, &wait) {
+		if wait.interrupted {
+			return ExitInterrupted
+		}
+		return ExitTimeout
+	}
+
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) {
+		return ExitError
+	}
+	switch clientErr.Kind {
+	case client.KindUnreachable:
+		return ExitUnreachable
+	case client.KindRejected, client.KindNotFound, client.KindConflict, client.KindStatus:
+		return ExitRejected
+	case client.KindMalformed:
+		return ExitMalformed
+	case client.KindTLS:
+		return ExitTLS
+	case client.KindUnauthorized, client.KindForbidden:
+		return ExitAuth
+	case client.KindServer:
+		return ExitServer
+	case client.KindTimeout:
+		return ExitTimeout
+	case client.KindCanceled:
+		return ExitInterrupted
+	default:
+		return ExitError
+	}
+}
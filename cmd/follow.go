@@ -0,0 +1,232 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of the log commands.
+var (
+	logFollow     bool
+	logTail       int
+	logTimestamps bool
+)
+
+// addLogFlags adds the flags shared by the log commands.
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&logFollow, "follow", "f", false, "keep printing the log as it grows")
+	cmd.Flags().IntVar(&logTail, "tail", -1, "only print the last N lines of the log, -1 for all")
+	cmd.Flags().BoolVar(&logTimestamps, "timestamps", false, "prefix every line with the time it was received, requires --follow")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", 2*time.Second, "how often to fetch the log with --follow")
+}
+
+// checkLogFlags rejects the log flags that make no sense together.
+func checkLogFlags() error {
+	if (logFollow || logTimestamps) && outputFormat != outputTable {
+		return badInputf("--follow and --timestamps print the log as text, they cannot be used with --output %s", outputFormat)
+	}
+	if logTimestamps && !logFollow {
+		return badInputf("--timestamps requires --follow, the manager does not time log lines")
+	}
+	return nil
+}
+
+// lastLines returns the end of log holding its last n lines, or all of log if
+// n is negative.
+func lastLines(log string, n int) string {
+	if n < 0 {
+		return log
+	}
+	end := strings.TrimSuffix(log, "\n")
+	start := len(end)
+	for i := 0; i < n; i++ {
+		start = strings.LastIndex(end[:start], "\n")
+		if start < 0 {
+			return log
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return log[start+1:]
+}
+
+// follower prints a log that the manager only serves whole, one new line at a
+// time. It remembers how much of the log was already printed.
+type follower struct {
+	w io.Writer
+	// prefix is printed before every line
+	prefix string
+	// tail is the number of lines of the first log fed that are printed,
+	// -1 for all
+	tail       int
+	timestamps bool
+
+	started bool
+	offset  int
+	partial string
+}
+
+// feed prints the whole lines added to log since the last call. A log that
+// shrank was replaced and is printed again from its start.
+func (f *follower) feed(log string) {
+	if !f.started {
+		f.offset = len(log) - len(lastLines(log, f.tail))
+		f.started = true
+	}
+	if len(log) < f.offset {
+		f.offset, f.partial = 0, ""
+	}
+	text := f.partial + log[f.offset:]
+	f.offset = len(log)
+
+	lines := strings.SplitAfter(text, "\n")
+	f.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		f.print(line)
+	}
+}
+
+// flush prints the last line, even if it is not over yet.
+func (f *follower) flush() {
+	if f.partial != "" {
+		f.print(f.partial + "\n")
+		f.partial = ""
+	}
+}
+
+// print writes line with a single call, so that followers sharing a writer
+// never mix their lines.
+func (f *follower) print(line string) {
+	if f.timestamps {
+		line = time.Now().Format(time.RFC3339) + " " + line
+	}
+	io.WriteString(f.w, f.prefix+line)
+}
+
+// followLog polls a log with fetch and prints it with f until over reports
+// true, or until ctx is canceled, e.g. with Ctrl-C, if over is nil. The log is
+// fetched one last time once over is true, so that nothing is missed.
+// Stopping with ctx is not an error.
+func followLog(ctx context.Context, f *follower, fetch func(ctx context.Context) (string, error), over func(ctx context.Context) (bool, error)) error {
+	defer f.flush()
+	for {
+		done := false
+		if over != nil {
+			var err error
+			done, err = over(ctx)
+			if err != nil && ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		log, err := fetch(ctx)
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.feed(log)
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// fetchJobLog returns a fetch function for followLog that gets the log of the
+// job with id.
+func fetchJobLog(cmd *cobra.Command, id string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		ctx, cancel := requestContext(ctx, cmd)
+		defer cancel()
+		response, err := manager().JobLog(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return response.Data, nil
+	}
+}
+
+// fetchNodeLog returns a fetch function for followLog that gets the log of
+// the node with id.
+func fetchNodeLog(cmd *cobra.Command, id string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		ctx, cancel := requestContext(ctx, cmd)
+		defer cancel()
+		response, err := manager().NodeLog(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return response.Data, nil
+	}
+}
+
+// jobOver returns an over function for followLog that reports whether the
+// job with id is over.
+func jobOver(cmd *cobra.Command, id string) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		job, err := findJob(ctx, cmd, id)
+		if err != nil {
+			return false, err
+		}
+		return finished(job.Status), nil
+	}
+}
+
+// syncWriter serializes the writes of several followers to w.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// prefixColors are the ANSI colors given in turn to the nodes of pod logs.
+var prefixColors = []string{"36", "33", "32", "35", "34", "31"}
+
+// colorPrefixes returns the prefix of the lines of every name, padded to the
+// same width and colored when w is a terminal and NO_COLOR is not set.
+func colorPrefixes(w io.Writer, names []string) []string {
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	color := isTerminal(w) && !noColor
+
+	prefixes := make([]string, len(names))
+	for i, name := range names {
+		prefix := fmt.Sprintf("%-*s", width, name)
+		if color {
+			prefix = "\033[" + prefixColors[i%len(prefixColors)] + "m" + prefix + "\033[0m"
+		}
+		prefixes[i] = prefix + " | "
+	}
+	return prefixes
+}
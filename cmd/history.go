@@ -0,0 +1,249 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/history"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of job history and job rerun.
+var (
+	historyLimit int
+	rerunName    string
+)
+
+var jobHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the jobs launched from here",
+	Long: `List the jobs launched from here with job launch, job sweep and job rerun,
+the latest last, across sessions. A job of the list can be launched again with
+job rerun.
+
+The history is kept next to the config file, with a copy of every script.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if historyLimit < 0 {
+			return badInputf("--limit cannot be negative")
+		}
+		store, err := historyStore()
+		if err != nil {
+			return err
+		}
+		subs, err := store.List()
+		if err != nil {
+			return badInputf("could not read the history: %v", err)
+		}
+		if historyLimit > 0 && len(subs) > historyLimit {
+			subs = subs[len(subs)-historyLimit:]
+		}
+
+		// Print the response
+		response := &cliResponse[[]history.Submission]{Status: true, Msg: fmt.Sprintf("%d jobs launched", len(subs)), Data: subs}
+		var ids []string
+		for _, sub := range subs {
+			ids = append(ids, sub.Id)
+		}
+		return printResponse(cmd, response, ids, func(w io.Writer) {
+			if len(subs) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No jobs launched yet")
+				return
+			}
+
+			headers := []string{"JOB ID", "NAME", "LAUNCHED", "SCRIPT", "SHA256", "RERUN OF"}
+			if wide {
+				headers = append(headers, "ARGS", "MANAGER")
+			}
+			t := newTable(headers...)
+			for _, sub := range subs {
+				sum := sub.Sha256
+				if !wide && len(sum) > 12 {
+					sum = sum[:12]
+				}
+				row := []string{sub.Id, sub.Name, sub.Time.Local().Format(time.RFC3339), sub.Script, sum, sub.RerunOf}
+				if wide {
+					var args []string
+					if sub.Spec != nil {
+						args = sub.Spec.Args
+					}
+					row = append(row, quoteArgs(args), sub.Manager)
+				}
+				t.addRow(row...)
+			}
+			t.render(w)
+		})
+	},
+}
+
+var jobRerunCmd = &cobra.Command{
+	Use:   "rerun [job_id]",
+	Short: "Launch a job again, as it was launched from here",
+	Long: `Launch a job again with the same name, script, arguments, environment and
+resources, as recorded by job history. The script is the copy kept when the
+job was launched, even if the file changed since. The files of a bundle are
+read again, but the job is not launched if any of them changed, was added or
+was removed.
+
+With --wait, the job is followed like with job launch --wait.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := historyStore()
+		if err != nil {
+			return err
+		}
+		old, err := store.Find(args[0])
+		if err != nil {
+			return badInputf("could not read the history: %v", err)
+		}
+		if old == nil {
+			return badInputf("job %s was not launched from here, see job history", args[0])
+		}
+		if old.Manager != ManagerEp {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Job %s was launched on %s, launching it again on %s\n", old.Id, old.Manager, ManagerEp)
+		}
+
+		// Collect the files
+		sub := *old
+		sub.RerunOf = old.Id
+		if rerunName != "" {
+			sub.Name = rerunName
+		}
+		var upload *client.JobUpload
+		if old.Entrypoint != "" {
+			var bundle *bundle
+			upload, bundle, err = rerunBundle(old)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Uploading %d files (%s) to run %s\n", len(bundle.files), formatSize(bundle.size), upload.Entrypoint)
+		} else {
+			// Check the copy of the script before launching anything
+			script, err := store.OpenScript(old.Sha256)
+			if err != nil {
+				return badInputf("cannot launch job %s again: %v", old.Id, err)
+			}
+			script.Close()
+			upload, err = scriptUpload(cmd, &sub, old.Filename, nil)
+			if err != nil {
+				return err
+			}
+		}
+		upload.Spec = old.Spec
+		return launchJob(cmd, upload, &sub)
+	},
+}
+
+// rerunBundle collects the files of the bundle of sub again, as they were
+// recorded. The job is not launched again if any of them changed.
+func rerunBundle(sub *history.Submission) (*client.JobUpload, *bundle, error) {
+	upload, bundle, err := bundleUpload(bundleSpec{script: sub.Script, files: sub.Files, entrypoint: sub.Entrypoint})
+	if err != nil {
+		return nil, nil, err
+	}
+	sums, err := bundle.sums()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed []string
+	for name, sum := range sub.Bundle {
+		if sums[name] != sum {
+			changed = append(changed, name)
+		}
+	}
+	for name := range sums {
+		if _, ok := sub.Bundle[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		return nil, nil, badInputf("the files of job %s changed since it was launched: %s, launch it with job launch instead", sub.Id, strings.Join(changed, ", "))
+	}
+	return upload, bundle, nil
+}
+
+// historyStore returns the history, kept in the directory of the config file.
+func historyStore() (*history.Store, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	return history.Open(filepath.Join(filepath.Dir(path), "history")), nil
+}
+
+// keepScript keeps a copy of the script opened by open in the history and
+// sets sub.Sha256. A copy that cannot be kept only gets a warning, sub is then
+// not recorded.
+func keepScript(cmd *cobra.Command, sub *history.Submission, open func() (io.ReadCloser, error)) error {
+	script, err := open()
+	if err != nil {
+		return badInput(err)
+	}
+	defer script.Close()
+
+	store, err := historyStore()
+	if err == nil {
+		sub.Sha256, err = store.Keep(script)
+	}
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: could not keep a copy of the script in the history: %v\n", err)
+	}
+	return nil
+}
+
+// keepBundle records the files of bundle in sub and keeps a copy of its
+// entrypoint in the history.
+func keepBundle(cmd *cobra.Command, sub *history.Submission, bundle *bundle, entrypoint string) error {
+	sums, err := bundle.sums()
+	if err != nil {
+		return err
+	}
+	sub.Entrypoint, sub.Bundle = entrypoint, sums
+	return keepScript(cmd, sub, func() (io.ReadCloser, error) {
+		return os.Open(bundle.names[entrypoint])
+	})
+}
+
+// recordSubmission adds sub to the history, unless its script could not be
+// kept. A job that could not be recorded was still launched, so only a
+// warning is printed.
+func recordSubmission(cmd *cobra.Command, sub *history.Submission) {
+	if sub.Sha256 == "" {
+		return
+	}
+	store, err := historyStore()
+	if err == nil {
+		sub.Time, sub.Manager = time.Now(), ManagerEp
+		err = store.Add(sub)
+	}
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: could not record job %s in the history: %v\n", sub.Id, err)
+	}
+}
+
+func init() {
+	jobCmd.AddCommand(jobHistoryCmd)
+	jobCmd.AddCommand(jobRerunCmd)
+
+	// Rerunning uploads the script
+	setTimeout(jobRerunCmd, 2*time.Minute)
+
+	addTableFlags(jobHistoryCmd)
+	jobHistoryCmd.Flags().IntVar(&historyLimit, "limit", 20, "how many of the latest jobs to list, 0 for all")
+
+	jobRerunCmd.Flags().StringVar(&rerunName, "name", "", "name of the new job (default the name of the job)")
+	jobRerunCmd.Flags().BoolVarP(&launchWait, "wait", "w", false, "wait for the job to end and print its log")
+	addWaitFlags(jobRerunCmd)
+}
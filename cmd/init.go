@@ -4,60 +4,39 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var initEp string = "/cloud/"
-
-type initResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize the cloud, may take a couple seconds",
 	Args:  cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+initEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().Init(cmd.Context())
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response initResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
 
+	// Initializing the cloud may take a couple minutes
+	setTimeout(initCmd, 5*time.Minute)
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -4,49 +4,19 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/history"
 
 	"github.com/spf13/cobra"
 )
 
-var jobEp = "/cloud/job/"
-
-type jobLsResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		Name   string `json:"name"`
-		Id     string `json:"id"`
-		Status string `json:"status"`
-		Node   string `json:"node"`
-	} `json:"data"`
-}
-
-type jobLaunchResp struct {
-	Status bool `json:"status"`
-	Data   struct {
-		Id string `json:"job_id"`
-	} `json:"data"`
-}
-
-type jobAbortResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
-type jobLogResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   string `json:"data"`
-}
-
 var jobCmd = &cobra.Command{
 	Use:   "job",
 	Short: "All commands related to job",
@@ -56,195 +26,284 @@ var jobLsCmd = &cobra.Command{
 	Use:   "ls [node_id]",
 	Short: "List all jobs on a specific nodo. If no node is specified, all jobs will be listed",
 	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodGet, ManagerEp+jobEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var nodeId string
 		if len(args) > 0 {
-			params := req.URL.Query()
-			params.Add("node_id", args[0])
-			req.URL.RawQuery = params.Encode()
+			nodeId = args[0]
 		}
 
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().ListJobs(cmd.Context(), nodeId)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response jobLsResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+		// Print the response
+		var ids []string
+		for _, job := range response.Data {
+			ids = append(ids, job.Id)
 		}
+		return printResponse(cmd, response, ids, func(w io.Writer) {
+			if len(response.Data) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No jobs found")
+				return
+			}
 
-		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
+			t := newTable("ID", "NAME", "STATUS", "NODE")
 			for _, job := range response.Data {
-				fmt.Printf("| ID: %s | Name: %s | Status: %s | Node: %s |\n",
-					job.Id, job.Name, job.Status, job.Node)
+				t.addRow(job.Id, job.Name, job.Status, job.Node)
 			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+			t.render(w)
+		})
 	},
 }
 
+// launchWait is set by job launch --wait
+var launchWait bool
+
 var jobLaunchCmd = &cobra.Command{
-	Use:   "launch [job_name] [job_script]",
+	Use:   "launch [job_name] [job_script] [-- script_args...]",
 	Short: "Launch a job given a job name and a job script",
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Prepare the script
-		file, err := os.Open(args[1])
-		filename := filepath.Base(args[1])
-		if err != nil {
-			panic(err)
+	Long: `Launch a job given a job name and a job script.
+
+The job may need more files than its script: the script can be a directory,
+run from its run.sh, its only .sh file or --entrypoint, or files and
+directories can be added to the script with --file. The files are sent along
+with the script as a gzipped tar archive, but for those matched by a
+.cloudignore file in the directory, or next to the script. The .cloudignore
+file has a pattern per line, like a .gitignore file.
+
+With --wait, the job is followed until it completes, fails or is aborted. The
+progress is shown on stderr and the job log is printed once the job is over.
+The exit code is then 0 if the job completed, 10 if it failed, 11 if it was
+aborted and 8 if it did not end within --wait-timeout. With an --output other
+than table, only the launch response is printed.
+
+Many jobs can be launched at once, --parallel at a time, from a manifest given
+with --filename and from every script matching --glob, e.g.
+
+  cloud job launch -f jobs.yaml
+  cloud job launch --glob 'scripts/*.sh'
+
+A manifest is a list of jobs, scripts are relative to the manifest and count
+launches the same script several times, as <name>-1 to <name>-<count>:
+
+  - name: train
+    script: train.sh
+    count: 3
+  - name: report
+    script: report.sh
+
+Jobs found with --glob are named after their script. A summary of the jobs
+launched and of the failures is printed once every job was sent.
+
+The arguments after -- are passed to the script, and --env and --env-file set
+its environment, e.g.
+
+  cloud job launch train train.sh --env-file .env -e EPOCHS=10 -- --lr 0.1
+
+--cpu, --memory and --job-timeout ask the manager for resources and for how
+long the job may run. --timeout is only how long to wait for the manager. What
+a job was launched with is shown by job describe.
+
+Every job launched is recorded with a copy of its script, see job history, and
+can be launched again with job rerun.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		args, _ = splitArgs(cmd, args)
+		if isBatch() {
+			return cobra.NoArgs(cmd, args)
 		}
-		defer file.Close()
-
-		buf := new(bytes.Buffer)
-		io.Copy(buf, file)
-
-		body := new(bytes.Buffer)
-		writer := multipart.NewWriter(body)
-
-		part, err := writer.CreateFormFile("job_script", filename)
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		args, scriptArgs := splitArgs(cmd, args)
+		spec, err := jobSpec(scriptArgs)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		io.Copy(part, buf)
-
-		err = writer.Close()
-		if err != nil {
-			panic(err)
+		if isBatch() {
+			return launchBatch(cmd, spec)
 		}
 
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+jobEp, body)
+		// Collect the files
+		path, err := absPath(args[1])
 		if err != nil {
-			panic(err)
+			return err
 		}
-		req.Header.Set("Content-Type", writer.FormDataContentType())
-
-		params := req.URL.Query()
-		params.Add("job_name", args[0])
-		req.URL.RawQuery = params.Encode()
+		sub := &history.Submission{Name: args[0], Script: path, Spec: spec}
+		var upload *client.JobUpload
+		if isBundle(args[1]) {
+			var bundle *bundle
+			upload, bundle, err = bundleUpload(bundleSpec{script: args[1], files: launchFiles, entrypoint: launchEntrypoint})
+			if err != nil {
+				return err
+			}
+			for _, file := range launchFiles {
+				path, err := absPath(file)
+				if err != nil {
+					return err
+				}
+				sub.Files = append(sub.Files, path)
+			}
+			err = keepBundle(cmd, sub, bundle, upload.Entrypoint)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Uploading %d files (%s) to run %s\n", len(bundle.files), formatSize(bundle.size), upload.Entrypoint)
+		} else {
+			upload, err = scriptUpload(cmd, sub, filepath.Base(args[1]), func() (io.ReadCloser, error) {
+				return os.Open(args[1])
+			})
+			if err != nil {
+				return err
+			}
+		}
+		upload.Spec = spec
+		sub.Filename = upload.Filename
+		return launchJob(cmd, upload, sub)
+	},
+}
 
-		// Send the request
-		res, err := Client.Do(req)
+// scriptUpload returns the upload of a job made of a script only, named
+// filename. Unless sub.Sha256 is already kept in the history, a copy of the
+// script opened by open is kept for sub first. The copy is uploaded, so that
+// the script recorded is the script launched.
+func scriptUpload(cmd *cobra.Command, sub *history.Submission, filename string, open func() (io.ReadCloser, error)) (*client.JobUpload, error) {
+	upload := &client.JobUpload{Filename: filename, OpenScript: open}
+	if sub.Sha256 == "" {
+		err := keepScript(cmd, sub, open)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response jobLaunchResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+	}
+	if sum := sub.Sha256; sum != "" {
+		store, err := historyStore()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-
-		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Data.Id)
-		} else {
-			fmt.Print("Failed: ")
+		upload.OpenScript = func() (io.ReadCloser, error) {
+			return store.OpenScript(sum)
 		}
+	}
+	return upload, nil
+}
 
-	},
+// launchJob launches the job of upload, records it in the history as sub,
+// prints the response and follows the job with --wait.
+func launchJob(cmd *cobra.Command, upload *client.JobUpload, sub *history.Submission) error {
+	// Send the request
+	response, err := manager().LaunchJobUpload(cmd.Context(), sub.Name, upload)
+	if err != nil {
+		return err
+	}
+	sub.Id = response.Data.Id
+	recordSubmission(cmd, sub)
+
+	// Print the response
+	err = printResponse(cmd, response, []string{response.Data.Id}, func(w io.Writer) {
+		fmt.Fprint(w, "Success: ")
+		fmt.Fprintln(w, response.Data.Id)
+	})
+	if err != nil || !launchWait {
+		return err
+	}
+
+	// Follow the job
+	job, err := waitJob(cmd, response.Data.Id)
+	if err != nil {
+		return err
+	}
+	if outputFormat == outputTable {
+		err = printJobLog(cmd, job.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return jobResult(job)
 }
 
 var jobAbortCmd = &cobra.Command{
-	Use:   "abort [job_id]",
+	Use:   "abort [job_id]...",
 	Short: "Abort a job given that job's ID",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodDelete, ManagerEp+jobEp, nil)
-		if err != nil {
-			panic(err)
-		}
+	Long: `Abort a job given that job's ID.
 
-		params := req.URL.Query()
-		params.Add("job_id", args[0])
-		req.URL.RawQuery = params.Encode()
+Several jobs can be aborted at once, given by id or selected among the jobs
+that are not over with --all, --node, --status and --name-pattern, e.g.
 
-		// Send the request
-		res, err := Client.Do(req)
-		if err != nil {
-			panic(err)
+  cloud job abort --status registered --name-pattern 'train-*'
+
+The jobs are listed and a confirmation is asked for, unless --yes is given,
+then the result of every abort is printed.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || hasAbortSelector() {
+			return abortJobs(cmd, args)
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response jobAbortResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		// Send the request
+		response, err := manager().AbortJob(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
 	},
 }
 
 var jobLogCmd = &cobra.Command{
 	Use:   "log [job_id]",
 	Short: "Output the log of a specific job",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-        req, err := http.NewRequest(http.MethodGet, ManagerEp+jobEp+"log/", nil)
-		if err != nil {
-			panic(err)
-		}
+	Long: `Output the log of a specific job.
 
-		params := req.URL.Query()
-		params.Add("job_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
-		// Send the request
-		res, err := Client.Do(req)
+With --follow, the log is printed as is and new lines are printed as they come
+until the job completes, fails or is aborted, or until Ctrl-C.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkLogFlags()
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if logFollow {
+			f := &follower{w: cmd.OutOrStdout(), tail: logTail, timestamps: logTimestamps}
+			return followLog(cmd.Root().Context(), f, fetchJobLog(cmd, args[0]), jobOver(cmd, args[0]))
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response jobLogResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		// Send the request
+		response, err := manager().JobLog(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
+		response.Data = lastLines(response.Data, logTail)
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-			fmt.Println(response.Data)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+			fmt.Fprintln(w, response.Data)
+		})
 	},
 }
 
+// printJobLog prints the log of the job with id as is.
+func printJobLog(cmd *cobra.Command, id string) error {
+	ctx, cancel := requestContext(cmd.Root().Context(), cmd)
+	defer cancel()
+
+	response, err := manager().JobLog(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(cmd.OutOrStdout(), response.Data)
+	if response.Data != "" && !strings.HasSuffix(response.Data, "\n") {
+		fmt.Fprintln(cmd.OutOrStdout())
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(jobCmd)
 	jobCmd.AddCommand(jobLsCmd)
@@ -252,6 +311,28 @@ func init() {
 	jobCmd.AddCommand(jobAbortCmd)
 	jobCmd.AddCommand(jobLogCmd)
 
+	// Launching uploads the script
+	setTimeout(jobLaunchCmd, 2*time.Minute)
+
+	addTableFlags(jobLsCmd)
+
+	jobLaunchCmd.Flags().BoolVarP(&launchWait, "wait", "w", false, "wait for the job to end and print its log")
+	jobLaunchCmd.Flags().StringVarP(&launchManifest, "filename", "f", "", "manifest of the jobs to launch")
+	jobLaunchCmd.Flags().StringArrayVar(&launchGlobs, "glob", nil, "launch every script matching the pattern, can be repeated")
+	jobLaunchCmd.Flags().IntVar(&launchParallel, "parallel", 4, "how many jobs of a batch to launch at a time")
+	jobLaunchCmd.Flags().StringArrayVar(&launchFiles, "file", nil, "file or directory to send along with the script, can be repeated")
+	jobLaunchCmd.Flags().StringVar(&launchEntrypoint, "entrypoint", "", "script to run when the job script is a directory")
+	addSpecFlags(jobLaunchCmd)
+	jobLaunchCmd.Flags().StringVar(&launchMaxBundle, "max-bundle-size", "100MB", "the most the files sent with a job may take, e.g. 500MB")
+	addWaitFlags(jobLaunchCmd)
+	addLogFlags(jobLogCmd)
+
+	jobAbortCmd.Flags().BoolVar(&abortAll, "all", false, "abort every job that is not over")
+	jobAbortCmd.Flags().StringVar(&abortNode, "node", "", "only abort the jobs of this node")
+	jobAbortCmd.Flags().StringVar(&abortStatus, "status", "", "only abort the jobs with this status, running or registered")
+	jobAbortCmd.Flags().StringVar(&abortNamePattern, "name-pattern", "", "only abort the jobs whose name matches this glob, e.g. 'train-*'")
+	jobAbortCmd.Flags().BoolVarP(&abortYes, "yes", "y", false, "don't ask for a confirmation")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
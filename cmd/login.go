@@ -0,0 +1,244 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/config"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Flags of login.
+var (
+	loginUsername      string
+	loginPasswordStdin bool
+	loginToken         string
+	loginTokenStdin    bool
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to the manager of the current context and store the token",
+	Long: `Log in to the manager of the current context and store the token in the
+context. Every request to that manager is then sent with the token, requests
+to other managers never are.
+
+By default the username and the password are asked for. An existing token or
+api key can be stored as is with --token or --token-stdin. When the manager,
+e.g. given with --manager, is not that of the current context, the token is
+stored in the first context for it. If there is none, a context named
+"default" is created for it, unless "default" is for another manager.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ManagerEp == "" {
+			return client.ErrNoEndpoint
+		}
+		in := bufio.NewReader(cmd.InOrStdin())
+
+		// Get the token
+		newToken := loginToken
+		if loginTokenStdin {
+			line, err := readLine(cmd.Root().Context(), in)
+			if err == errInterrupted {
+				return err
+			}
+			if err != nil {
+				return badInputf("could not read the token: %v", err)
+			}
+			newToken = line
+		}
+		if newToken == "" {
+			username, password, err := credentials(cmd, in)
+			if err != nil {
+				return err
+			}
+
+			response, err := manager().Login(cmd.Context(), username, password)
+			if err != nil {
+				return err
+			}
+			newToken = response.Data.Token
+		}
+
+		// Store the token in the context of the manager
+		conf, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		name, err := loginContext(conf)
+		if err != nil {
+			return err
+		}
+		if conf.Contexts[name] == nil {
+			conf.SetContext(name, &config.Context{})
+		}
+		if conf.CurrentContext == "" {
+			conf.CurrentContext = name
+		}
+		conf.Contexts[name].Manager = ManagerEp
+		conf.Contexts[name].Token = newToken
+		err = conf.Save(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged in, token stored in context %q\n", name)
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the token stored in the current context",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if currentContext == "" {
+			return badInputf("no context in use, nothing to log out from")
+		}
+
+		conf, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		conf.Contexts[currentContext].Token = ""
+		err = conf.Save(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Logged out of context %q\n", currentContext)
+		return nil
+	},
+}
+
+// loginContext returns the name of the context to store the token of
+// ManagerEp in: the current context if it is for that manager, else the first
+// context for it, else "default" if it is for no other manager.
+func loginContext(conf *config.Config) (string, error) {
+	if context := conf.Contexts[currentContext]; context != nil && sameManager(context.Manager, ManagerEp) {
+		return currentContext, nil
+	}
+	for _, name := range conf.Names() {
+		if sameManager(conf.Contexts[name].Manager, ManagerEp) {
+			return name, nil
+		}
+	}
+	if context := conf.Contexts["default"]; context != nil && context.Manager != "" {
+		return "", badInputf("no context for %s and the context \"default\" is for %s, create one with 'cloud config set-context NAME --manager %s'", ManagerEp, context.Manager, ManagerEp)
+	}
+	return "default", nil
+}
+
+// credentials asks for the username and the password that were not given
+// with flags. The password is never echoed.
+func credentials(cmd *cobra.Command, in *bufio.Reader) (string, string, error) {
+	ctx := cmd.Root().Context()
+	stderr := cmd.ErrOrStderr()
+
+	username := loginUsername
+	if username == "" {
+		fmt.Fprint(stderr, "Username: ")
+		line, err := readLine(ctx, in)
+		if err == errInterrupted {
+			fmt.Fprintln(stderr)
+			return "", "", err
+		}
+		if err != nil {
+			return "", "", badInputf("could not read the username: %v", err)
+		}
+		username = line
+	}
+
+	var password string
+	if file, ok := cmd.InOrStdin().(*os.File); ok && !loginPasswordStdin && term.IsTerminal(int(file.Fd())) {
+		// The terminal echoes again only once ReadPassword returns, which
+		// it does not on Ctrl-C
+		fd := int(file.Fd())
+		state, err := term.GetState(fd)
+		if err != nil {
+			return "", "", badInputf("could not read the password: %v", err)
+		}
+		fmt.Fprint(stderr, "Password: ")
+		line, err := interruptible(ctx, func() (string, error) {
+			raw, err := term.ReadPassword(fd)
+			return string(raw), err
+		})
+		fmt.Fprintln(stderr)
+		if err == errInterrupted {
+			term.Restore(fd, state)
+			return "", "", err
+		}
+		if err != nil {
+			return "", "", badInputf("could not read the password: %v", err)
+		}
+		password = line
+	} else {
+		line, err := readLine(ctx, in)
+		if err == errInterrupted {
+			return "", "", err
+		}
+		if err != nil {
+			return "", "", badInputf("could not read the password: %v", err)
+		}
+		password = line
+	}
+
+	if username == "" || password == "" {
+		return "", "", badInputf("a username and a password are required")
+	}
+	return username, password, nil
+}
+
+// readLine reads a single line without its line ending, unless ctx is done
+// first.
+func readLine(ctx context.Context, in *bufio.Reader) (string, error) {
+	return interruptible(ctx, func() (string, error) {
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	})
+}
+
+// interruptible runs read, which blocks on stdin, and returns errInterrupted
+// if ctx is done first, e.g. on Ctrl-C. Reading stdin cannot be interrupted,
+// read is left to finish on its own.
+func interruptible(ctx context.Context, read func() (string, error)) (string, error) {
+	type answer struct {
+		line string
+		err  error
+	}
+	answers := make(chan answer, 1)
+	go func() {
+		line, err := read()
+		answers <- answer{line, err}
+	}()
+
+	select {
+	case a := <-answers:
+		return a.line, a.err
+	case <-ctx.Done():
+		return "", errInterrupted
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "username, asked for if not given")
+	loginCmd.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "read the password from stdin")
+	loginCmd.Flags().StringVar(&loginToken, "token", "", "store this token or api key instead of logging in")
+	loginCmd.Flags().BoolVar(&loginTokenStdin, "token-stdin", false, "read the token or api key to store from stdin")
+}
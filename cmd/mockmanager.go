@@ -0,0 +1,165 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/fakemanager"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of mock-manager.
+var (
+	mockListen      string
+	mockState       string
+	mockJobDuration time.Duration
+	mockToken       string
+	mockUsers       []string
+	mockTLSCert     string
+	mockTLSKey      string
+)
+
+// mockManagerCmd represents the mock-manager command
+var mockManagerCmd = &cobra.Command{
+	Use:   "mock-manager",
+	Short: "Run a local stand-in manager for demos and scripts",
+	Long: `Run a local stand-in manager that serves the same endpoints as the real
+one, e.g.
+
+  cloud mock-manager --listen :8443 &
+  MANAGER=http://localhost:8443 cloud init
+  MANAGER=http://localhost:8443 cloud pod ls
+
+Launched jobs wait for an idle job node, run for --job-duration while their
+script is printed to the job log, then complete, or fail if the script
+contains "exit 1". Server nodes get ports from 8000 on.
+
+With --token, every request must carry the token. cloud login then hands it
+out to the --user accounts, otherwise only 'cloud login --token' works:
+
+  cloud mock-manager --token s3cret --user bob:hunter2
+
+The state is kept in the --state file across restarts, remove the file to
+start over. Stop the manager with Ctrl-C.`,
+	Args: cobra.NoArgs,
+	// The mock manager talks to no manager and runs until it is stopped
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (mockTLSCert == "") != (mockTLSKey == "") {
+			return badInputf("--tls-cert and --tls-key must be set together")
+		}
+		if len(mockUsers) > 0 && mockToken == "" {
+			return badInputf("--user needs --token, the token cloud login hands out")
+		}
+		users := map[string]string{}
+		for _, user := range mockUsers {
+			name, password, ok := strings.Cut(user, ":")
+			if !ok || name == "" {
+				return badInputf("bad --user %q, expected name:password", user)
+			}
+			users[name] = password
+		}
+
+		m := fakemanager.New()
+		if mockState != "" {
+			var err error
+			m, err = fakemanager.Open(mockState)
+			if err != nil {
+				return badInput(err)
+			}
+		}
+		m.JobDuration = mockJobDuration
+		m.Token = mockToken
+		m.Users = users
+
+		listener, err := net.Listen("tcp", mockListen)
+		if err != nil {
+			return badInput(err)
+		}
+		stderr := cmd.ErrOrStderr()
+		server := &http.Server{Handler: logRequests(stderr, m)}
+
+		scheme := "http"
+		if mockTLSCert != "" {
+			scheme = "https"
+		}
+		fmt.Fprintf(stderr, "Mock manager listening on %s://%s\n", scheme, listener.Addr())
+
+		// Serve until Ctrl-C, cobra may keep the context of a previous
+		// execution on subcommands
+		ctx := cmd.Root().Context()
+		done := make(chan error, 1)
+		go func() {
+			if mockTLSCert != "" {
+				done <- server.ServeTLS(listener, mockTLSCert, mockTLSKey)
+			} else {
+				done <- server.Serve(listener)
+			}
+		}()
+
+		select {
+		case err = <-done:
+			return err
+		case <-ctx.Done():
+		}
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = server.Shutdown(shutdown)
+		if err != nil {
+			return err
+		}
+		err = <-done
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		fmt.Fprintln(stderr, "Mock manager stopped")
+		return nil
+	},
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request handled by h to w.
+func logRequests(w io.Writer, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+		h.ServeHTTP(recorder, req)
+		fmt.Fprintf(w, "%s %s %s %d %s\n", start.Format(time.RFC3339), req.Method, req.URL.Path, recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(mockManagerCmd)
+
+	// Here you will define your flags and configuration settings.
+	mockManagerCmd.Flags().StringVar(&mockListen, "listen", ":8443", "address to listen on")
+	mockManagerCmd.Flags().StringVar(&mockState, "state", "mock-manager.json", "file the state is kept in, empty to keep it in memory only")
+	mockManagerCmd.Flags().DurationVar(&mockJobDuration, "job-duration", 10*time.Second, "how long a simulated job runs, 0 to keep jobs registered")
+	mockManagerCmd.Flags().StringVar(&mockToken, "token", "", "bearer token required with every request, none if empty")
+	mockManagerCmd.Flags().StringArrayVar(&mockUsers, "user", nil, "name:password of an account cloud login accepts, may be repeated")
+	mockManagerCmd.Flags().StringVar(&mockTLSCert, "tls-cert", "", "PEM certificate to serve https with")
+	mockManagerCmd.Flags().StringVar(&mockTLSKey, "tls-key", "", "PEM key of --tls-cert")
+}
@@ -4,46 +4,12 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
 
 	"github.com/spf13/cobra"
 )
 
-var nodeEp string = "/cloud/node/"
-
-type nodeLsResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		Name   string `json:"node_name"`
-		Id     string `json:"node_id"`
-		Type   string `json:"node_type"`
-		Status string `json:"node_status"`
-		Pod    struct {
-			Name string `json:"pod_name"`
-			Id   string `json:"pod_id"`
-		} `json:"pod_data"`
-	} `json:"data"`
-}
-
-type nodeRegisterResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
-type nodeRmResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
-type nodeLogResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   string `json:"data"`
-}
-
 var nodeCmd = &cobra.Command{
 	Use:   "node",
 	Short: "All commands related to node",
@@ -53,45 +19,43 @@ var nodeLsCmd = &cobra.Command{
 	Use:   "ls [pod_id]",
 	Short: "List all nodes in a specific pod. If no pod is given, all nodes will be listed",
 	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodGet, ManagerEp+nodeEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var podId string
 		if len(args) > 0 {
-			params := req.URL.Query()
-			params.Add("pod_id", args[0])
-			req.URL.RawQuery = params.Encode()
+			podId = args[0]
 		}
 
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().ListNodes(cmd.Context(), podId)
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response nodeLsResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
+		var ids []string
+		for _, node := range response.Data {
+			ids = append(ids, node.Id)
+		}
+		return printResponse(cmd, response, ids, func(w io.Writer) {
+			if len(response.Data) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No nodes found")
+				return
+			}
+
+			headers := []string{"ID", "NAME", "TYPE", "STATUS", "POD"}
+			if wide {
+				headers = append(headers, "POD ID")
+			}
+			t := newTable(headers...)
 			for _, node := range response.Data {
-				fmt.Printf("| ID: %s |\n| Name: %s | Type: %s | Status: %s | Pod: %s |\n",
-					node.Id, node.Name, node.Type, node.Status, node.Pod.Name)
+				row := []string{node.Id, node.Name, node.Type, node.Status, node.Pod.Name}
+				if wide {
+					row = append(row, node.Pod.Id)
+				}
+				t.addRow(row...)
 			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+			t.render(w)
+		})
 	},
 }
 
@@ -99,41 +63,18 @@ var nodeRegisterCmd = &cobra.Command{
 	Use:   "register [node_type] [node_name] [pod_id]",
 	Short: "Register a node with a given type, name and a target pod id. The type can either be 'job' or 'server'",
 	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+nodeEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("node_type", args[0])
-		params.Add("node_name", args[1])
-		params.Add("pod_id", args[2])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().RegisterNode(cmd.Context(), args[0], args[1], args[2])
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response nodeRegisterResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
 	},
 }
 
@@ -141,79 +82,51 @@ var nodeRmCmd = &cobra.Command{
 	Use:   "rm [node_id]",
 	Short: "Remove a specific node given its name",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodDelete, ManagerEp+nodeEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("node_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response nodeRmResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		response, err := manager().RemoveNode(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
 	},
 }
 
 var nodeLogCmd = &cobra.Command{
 	Use:   "log [node_id]",
 	Short: "Output the log of a specific node",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodGet, ManagerEp+nodeEp+"log/", nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("node_id", args[0])
-		req.URL.RawQuery = params.Encode()
+	Long: `Output the log of a specific node.
 
-		// Send the request
-		res, err := Client.Do(req)
+With --follow, the log is printed as is and new lines are printed as they come
+until Ctrl-C.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkLogFlags()
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if logFollow {
+			f := &follower{w: cmd.OutOrStdout(), tail: logTail, timestamps: logTimestamps}
+			return followLog(cmd.Root().Context(), f, fetchNodeLog(cmd, args[0]), nil)
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response nodeLogResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		// Send the request
+		response, err := manager().NodeLog(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
+		response.Data = lastLines(response.Data, logTail)
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Data)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Data)
+		})
 	},
 }
 
@@ -224,6 +137,9 @@ func init() {
 	nodeCmd.AddCommand(nodeRmCmd)
 	nodeCmd.AddCommand(nodeLogCmd)
 
+	addTableFlags(nodeLsCmd)
+	addLogFlags(nodeLogCmd)
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
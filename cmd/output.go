@@ -0,0 +1,80 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by --output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputID    = "id"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML, outputID}
+
+var outputFormat string
+
+// checkOutputFormat rejects an unknown --output value before any request is
+// sent.
+func checkOutputFormat(cmd *cobra.Command, args []string) error {
+	return validOutputFormat(outputFormat)
+}
+
+// validOutputFormat returns an input error if format is not a known format.
+func validOutputFormat(format string) error {
+	for _, known := range outputFormats {
+		if format == known {
+			return nil
+		}
+	}
+	return badInputf("unknown output format %q, expected one of %s",
+		format, strings.Join(outputFormats, ", "))
+}
+
+// cliResponse is printed by the commands that answer on their own rather than
+// with a manager response, in the same shape as the manager responses.
+type cliResponse[T any] struct {
+	Status bool   `json:"status" yaml:"status"`
+	Msg    string `json:"msg" yaml:"msg"`
+	Data   T      `json:"data" yaml:"data"`
+}
+
+// printResponse prints response in the format selected with --output. table
+// writes the human readable output and ids are printed for --output id.
+func printResponse(cmd *cobra.Command, response any, ids []string, table func(w io.Writer)) error {
+	out := cmd.OutOrStdout()
+
+	switch outputFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	case outputYAML:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		err := encoder.Encode(response)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	case outputID:
+		for _, id := range ids {
+			fmt.Fprintln(out, id)
+		}
+		return nil
+	default:
+		table(out)
+		return nil
+	}
+}
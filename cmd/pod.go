@@ -4,38 +4,14 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"io"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
 
-var podEp string = "/cloud/pod/"
-
-type podLsResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		Name   string  `json:"pod_name"`
-		Id     string  `json:"pod_id"`
-		Type   string  `json:"pod_type"`
-		Elstic bool    `json:"is_elastic"`
-		Usage  float32 `json:"usage"`
-		Nodes  int     `json:"total_nodes"`
-	} `json:"data"`
-}
-
-type podRegisterResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
-type podRmResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-}
-
 var podCmd = &cobra.Command{
 	Use:   "pod",
 	Short: "All commands related to pod",
@@ -45,37 +21,31 @@ var podLsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List all pods",
 	Args:  cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodGet, ManagerEp+podEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().ListPods(cmd.Context())
 		if err != nil {
-			panic(err)
+			return err
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response podLsResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+		// Print the response
+		var ids []string
+		for _, pod := range response.Data {
+			ids = append(ids, pod.Id)
 		}
+		return printResponse(cmd, response, ids, func(w io.Writer) {
+			if len(response.Data) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No pods found")
+				return
+			}
 
-		// Print the response
-		if response.Status {
+			t := newTable("ID", "NAME", "TYPE", "ELASTIC", "USAGE", "NODES")
 			for _, pod := range response.Data {
-				fmt.Printf("| ID: %s |\n| Name: %s | Type: %s | Elastic: %t | Usage: %f | Nodes: %d |\n",
-					pod.Id, pod.Name, pod.Type, pod.Elstic, pod.Usage, pod.Nodes)
+				t.addRow(pod.Id, pod.Name, pod.Type, strconv.FormatBool(pod.Elastic),
+					fmt.Sprintf("%.2f", pod.Usage), strconv.Itoa(pod.Nodes))
 			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+			t.render(w)
+		})
 	},
 }
 
@@ -83,40 +53,18 @@ var podRegisterCmd = &cobra.Command{
 	Use:   "register [pod_type] [pod_name]",
 	Short: "Register a new pod given a pod type and a name",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+podEp, nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("pod_type", args[0])
-		params.Add("pod_name", args[1])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response podRegisterResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		response, err := manager().RegisterPod(cmd.Context(), args[0], args[1])
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
 	},
 }
 
@@ -124,39 +72,96 @@ var podRmCmd = &cobra.Command{
 	Use:   "rm [pod_id]",
 	Short: "Remove a specific pod given its id",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodDelete, ManagerEp+podEp, nil)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Send the request
+		response, err := manager().RemovePod(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		req.URL.RawQuery = params.Encode()
+		// Print the response
+		return printResponse(cmd, response, nil, func(w io.Writer) {
+			fmt.Fprint(w, "Success: ")
+			fmt.Fprintln(w, response.Msg)
+		})
+	},
+}
 
-		// Send the request
-		res, err := Client.Do(req)
+var podLogsCmd = &cobra.Command{
+	Use:   "logs [pod_id]",
+	Short: "Output the logs of every node of a pod",
+	Long: `Output the logs of every node of a pod, one node after the other. Every
+line is prefixed with the name of its node, in color on a terminal unless
+NO_COLOR is set.
+
+With --follow, the logs of all the nodes are printed as they come, interleaved,
+until Ctrl-C. The nodes are those of the pod when the command starts.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkLogFlags()
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if outputFormat != outputTable {
+			return badInputf("pod logs prints the logs as text, it cannot be used with --output %s", outputFormat)
 		}
-		defer res.Body.Close()
 
-		// Decode the response
-		var response podRmResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		// Find the nodes of the pod
+		response, err := manager().ListNodes(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if len(response.Data) == 0 {
+			fmt.Fprintln(cmd.ErrOrStderr(), "No nodes found")
+			return nil
 		}
 
-		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
+		var names []string
+		for _, node := range response.Data {
+			names = append(names, node.Name)
 		}
+		prefixes := colorPrefixes(cmd.OutOrStdout(), names)
+		out := &syncWriter{w: cmd.OutOrStdout()}
+		followers := make([]*follower, len(response.Data))
+		for i := range response.Data {
+			followers[i] = &follower{w: out, prefix: prefixes[i], tail: logTail, timestamps: logTimestamps}
+		}
+
+		// Print every log once
+		ctx, cancel := context.WithCancel(cmd.Root().Context())
+		defer cancel()
+		if !logFollow {
+			once := func(ctx context.Context) (bool, error) {
+				return true, nil
+			}
+			for i, node := range response.Data {
+				err = followLog(ctx, followers[i], fetchNodeLog(cmd, node.Id), once)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Follow every node until Ctrl-C or until one fails
+		errs := make(chan error, len(response.Data))
+		for i, node := range response.Data {
+			go func(f *follower, id string) {
+				err := followLog(ctx, f, fetchNodeLog(cmd, id), nil)
+				if err != nil {
+					cancel()
+				}
+				errs <- err
+			}(followers[i], node.Id)
+		}
+		var first error
+		for range response.Data {
+			err := <-errs
+			if err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
 	},
 }
 
@@ -165,6 +170,10 @@ func init() {
 	podCmd.AddCommand(podLsCmd)
 	podCmd.AddCommand(podRegisterCmd)
 	podCmd.AddCommand(podRmCmd)
+	podCmd.AddCommand(podLogsCmd)
+
+	addTableFlags(podLsCmd)
+	addLogFlags(podLogsCmd)
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
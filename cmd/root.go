@@ -4,28 +4,77 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"awsonbudget/cli/client"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
 )
 
 var ManagerEp string
-var Client = &http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	},
+var Client *http.Client
+
+// maxAttempts is the number of times a failed request is tried
+var maxAttempts int
+
+// manager returns a client for the manager at ManagerEp.
+func manager() *client.ManagerClient {
+	manager := client.New(ManagerEp, Client)
+	manager.Token = token
+	manager.Retry = client.DefaultRetryPolicy
+	manager.Retry.MaxAttempts = maxAttempts
+	return manager
 }
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "cloud",
 	Short: "cloud cli for comp598",
-	Long:  "cloud cli for comp598",
+	Long: `cloud cli for comp598
+
+Configuration:
+  The manager and the command defaults are taken from, in order: flags,
+  environment variables (MANAGER), a .env file in the current directory and
+  the current context of the config file. Contexts are managed with
+  'cloud config'.
+
+Exit codes:
+  0    success
+  1    unexpected error, e.g. a local file that could not be written
+  2    bad arguments, flags or local input
+  3    manager unreachable
+  4    manager rejected the request (status=false, HTTP 404, 409...)
+  5    malformed response from the manager
+  6    the manager's certificate could not be verified
+  7    not logged in, the token expired or not allowed (HTTP 401, 403)
+  8    timed out waiting for the manager, or for a job with --wait-timeout
+  9    the manager failed (HTTP 5xx)
+  10   the job waited for failed
+  11   the job waited for was aborted
+  130  interrupted with Ctrl-C
+
+Output formats (--output):
+  table  human readable output (default)
+  json   the full manager response as a JSON object,
+         {"status": bool, "msg": string, "data": ...}, where data keeps the
+         field names of the manager api, e.g. pod_id, pod_name, pod_type,
+         is_elastic, usage and total_nodes for pods
+  yaml   the same object as json, in YAML
+  id     one id per line: pod ids for pod ls, node ids for node ls and the
+         server commands, job ids for job ls and job launch, nothing for
+         commands that do not return ids`,
+	SilenceErrors:     true,
+	SilenceUsage:      true,
+	PersistentPreRunE: setup,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -34,16 +83,83 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-
+	// A .env file is optional, values already in the environment win
 	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fail(rootCmd, badInputf("could not load .env: %v", err))
+		os.Exit(ExitUsage)
+	}
+
+	// Ctrl-C cancels the request in flight instead of killing the process,
+	// so that we can tell whether it may have been applied
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// markUsage marks the errors of cobra once every command is registered.
+var markUsage sync.Once
+
+// run executes the command line args and returns the exit code.
+func run(ctx context.Context, args []string) int {
+	markUsage.Do(func() { markUsageErrors(rootCmd) })
+	rootCmd.SetArgs(args)
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	cancelTimeout()
+
+	// An unknown command is reported before any command runs, the same
+	// error is found again
+	if _, _, findErr := rootCmd.Find(args); err != nil && findErr != nil && findErr.Error() == err.Error() {
+		err = &usageError{err: err}
+	}
 	if err != nil {
-		panic(err)
+		fail(cmd, err)
 	}
-	ManagerEp = os.Getenv("MANAGER")
+	return exitCode(err)
+}
 
-	err = rootCmd.Execute()
+// setup runs before every command but the config ones.
+func setup(cmd *cobra.Command, args []string) error {
+	err := loadSettings(cmd)
 	if err != nil {
-		os.Exit(1)
+		return err
+	}
+	applyTimeout(cmd)
+	return checkOutputFormat(cmd, args)
+}
+
+// fail reports err on stderr, with a hint on how to fix it when we have one.
+func fail(cmd *cobra.Command, err error) {
+	stderr := cmd.ErrOrStderr()
+	fmt.Fprintln(stderr, "Error:", err)
+
+	// Errors raised by cobra itself deserve a pointer to the usage
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+	if client.KindOf(err) == client.KindTLS {
+		fmt.Fprintln(stderr, "Trust the manager's CA with --ca-cert, or skip the verification with --insecure-skip-tls-verify.")
+	}
+	if client.KindOf(err) == client.KindUnauthorized && cmd != loginCmd {
+		fmt.Fprintln(stderr, "Run 'cloud login' to log in again.")
+	}
+	if kind := client.KindOf(err); kind == client.KindTimeout || kind == client.KindCanceled {
+		if mayHaveApplied(err) {
+			fmt.Fprintln(stderr, "The request reached the manager and may have been applied, check the current state before retrying.")
+		} else {
+			fmt.Fprintln(stderr, "The request did not change anything on the manager.")
+		}
+	}
+	var wait *waitError
+	if errors.As(err, &wait) && wait.workflow != "" {
+		fmt.Fprintln(stderr, "The jobs launched are still on the manager, check them with 'cloud job ls'. The others were not launched.")
+	} else if errors.As(err, &wait) {
+		fmt.Fprintf(stderr, "The job is still on the manager, check it with 'cloud job ls' or 'cloud job log %s'.\n", wait.id)
+	}
+	if errors.Is(err, client.ErrNoEndpoint) {
+		fmt.Fprintln(stderr, "Set one with --manager, MANAGER or 'cloud config set-context'.")
 	}
 }
 
@@ -52,7 +168,16 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cli.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $XDG_CONFIG_HOME/cloud/config.yaml, also set by CLOUD_CONFIG)")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "context of the config file to use (also set by CLOUD_CONTEXT)")
+	rootCmd.PersistentFlags().StringVar(&managerFlag, "manager", "", "url of the manager, overrides MANAGER and the context")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "how long to wait for the manager, e.g. 30s or 5m, 0 to wait forever (default 30s, longer for slow commands)")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", client.DefaultRetryPolicy.MaxAttempts, "how many times to try a request, reads are retried on network errors and busy managers, other requests only if the connection was refused")
+	rootCmd.PersistentFlags().StringVar(&caCertFlag, "ca-cert", "", "PEM bundle of the CA that signed the manager's certificate")
+	rootCmd.PersistentFlags().StringVar(&clientCertFlag, "client-cert", "", "PEM client certificate for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&clientKeyFlag, "client-key", "", "PEM client key for mutual TLS")
+	rootCmd.PersistentFlags().BoolVar(&insecureFlag, "insecure-skip-tls-verify", false, "don't verify the manager's certificate, this is insecure")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format: table, json, yaml or id")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
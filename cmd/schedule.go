@@ -0,0 +1,505 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+	"awsonbudget/cli/schedule"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of job schedule and scheduler run.
+var (
+	scheduleAt        string
+	scheduleCron      string
+	schedulerOnce     bool
+	schedulerInterval time.Duration
+)
+
+var jobScheduleCmd = &cobra.Command{
+	Use:   "schedule [job_name] [job_script] [-- script_args...]",
+	Short: "Launch a job later, once or on a cron schedule",
+	Long: `Schedule a job to be launched once --at a given time, or every time the cron
+expression --cron matches, e.g.
+
+  cloud job schedule report report.sh --at 18:30
+  cloud job schedule nightly train.sh --cron "0 2 * * *" -- --epochs 10
+
+--at takes a time such as 2024-05-01T18:30:00+02:00, 2024-05-01 18:30, 18:30
+for the next 18:30 or +2h for two hours from now. --cron takes the five fields
+minute, hour, day of the month, month and day of the week, in local time, or
+@hourly, @daily, @weekly, @monthly and @yearly.
+
+A copy of the script is kept with the history, later changes to the file are
+not launched. The jobs are launched by 'cloud scheduler run', which must be
+running at that time, on the manager they were scheduled for. A job scheduled
+--at a time is tried again until it launches. The schedules are kept next to
+the config file, list them with 'schedule ls'.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		args, _ = splitArgs(cmd, args)
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		args, scriptArgs := splitArgs(cmd, args)
+		if (scheduleAt == "") == (scheduleCron == "") {
+			return badInputf("give either --at or --cron")
+		}
+		if ManagerEp == "" {
+			return client.ErrNoEndpoint
+		}
+		spec, err := jobSpec(scriptArgs)
+		if err != nil {
+			return err
+		}
+
+		// Check the script
+		info, err := os.Stat(args[1])
+		if err != nil {
+			return badInput(err)
+		}
+		if info.IsDir() {
+			return badInputf("%s is a directory, job schedule takes a single script", args[1])
+		}
+		path, err := absPath(args[1])
+		if err != nil {
+			return err
+		}
+
+		// Find the first launch
+		now := time.Now()
+		entry := &schedule.Entry{
+			Name:     args[0],
+			Script:   path,
+			Filename: filepath.Base(path),
+			Spec:     spec,
+			Manager:  ManagerEp,
+			Created:  now,
+		}
+		if scheduleAt != "" {
+			at, err := parseAt(scheduleAt, now)
+			if err != nil {
+				return err
+			}
+			entry.At, entry.Next = &at, &at
+		} else {
+			c, err := schedule.ParseCron(scheduleCron)
+			if err != nil {
+				return badInput(err)
+			}
+			next := c.Next(now)
+			if next.IsZero() {
+				return badInputf("--cron %q never matches", scheduleCron)
+			}
+			entry.Cron, entry.Next = c.String(), &next
+		}
+
+		// Keep a copy of the script in the history
+		script, err := os.Open(path)
+		if err != nil {
+			return badInput(err)
+		}
+		defer script.Close()
+		scripts, err := historyStore()
+		if err != nil {
+			return err
+		}
+		entry.Sha256, err = scripts.Keep(script)
+		if err != nil {
+			return fmt.Errorf("could not keep a copy of %s: %w", args[1], err)
+		}
+
+		store, err := scheduleStore()
+		if err != nil {
+			return err
+		}
+		err = store.Update(func(f *schedule.File) error {
+			f.Add(entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not save the schedule: %w", err)
+		}
+
+		// Print the response
+		response := &cliResponse[[]*schedule.Entry]{Status: true, Msg: "job " + entry.Name + " scheduled", Data: []*schedule.Entry{entry}}
+		return printResponse(cmd, response, []string{entry.Id}, func(w io.Writer) {
+			fmt.Fprintf(w, "Success: %s, first launch at %s\n", entry.Id, formatTime(entry.Next))
+			fmt.Fprintln(cmd.ErrOrStderr(), "The job is launched by 'cloud scheduler run', which must be running at that time.")
+		})
+	},
+}
+
+var scheduleLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the scheduled jobs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := scheduleStore()
+		if err != nil {
+			return err
+		}
+		f, err := store.Load()
+		if err != nil {
+			return fmt.Errorf("could not read the schedules: %w", err)
+		}
+
+		// Print the response
+		response := &cliResponse[[]*schedule.Entry]{Status: true, Msg: fmt.Sprintf("%d jobs scheduled", len(f.Entries)), Data: f.Entries}
+		var ids []string
+		for _, entry := range f.Entries {
+			ids = append(ids, entry.Id)
+		}
+		return printResponse(cmd, response, ids, func(w io.Writer) {
+			if len(f.Entries) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No jobs scheduled")
+				return
+			}
+
+			headers := []string{"ID", "NAME", "WHEN", "NEXT", "LAST RUN", "RESULT"}
+			if wide {
+				headers = append(headers, "RUNS", "SCRIPT", "MANAGER")
+			}
+			t := newTable(headers...)
+			for _, entry := range f.Entries {
+				when := "cron " + entry.Cron
+				if entry.At != nil {
+					when = "at " + formatTime(entry.At)
+				}
+				last, result := unknown, ""
+				if len(entry.Runs) > 0 {
+					run := entry.Runs[len(entry.Runs)-1]
+					last, result = formatTime(&run.Time), run.Id
+					if run.Error != "" {
+						result = "error: " + run.Error
+					}
+				}
+				row := []string{entry.Id, entry.Name, when, formatTime(entry.Next), last, result}
+				if wide {
+					row = append(row, fmt.Sprint(len(entry.Runs)), entry.Script, entry.Manager)
+				}
+				t.addRow(row...)
+			}
+			t.render(w)
+		})
+	},
+}
+
+var scheduleRmCmd = &cobra.Command{
+	Use:   "rm [schedule_id]...",
+	Short: "Remove scheduled jobs",
+	Long: `Remove scheduled jobs, so that they are not launched anymore. The jobs already
+launched are left as they are.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := scheduleStore()
+		if err != nil {
+			return err
+		}
+		var removed []*schedule.Entry
+		err = store.Update(func(f *schedule.File) error {
+			for _, id := range args {
+				entry := f.Find(id)
+				if entry == nil {
+					return badInputf("schedule %s not found, see schedule ls", id)
+				}
+				f.Remove(id)
+				removed = append(removed, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			if exitCode(err) == ExitUsage {
+				return err
+			}
+			return fmt.Errorf("could not save the schedules: %w", err)
+		}
+
+		// Print the response
+		response := &cliResponse[[]*schedule.Entry]{Status: true, Msg: fmt.Sprintf("%d schedules removed", len(removed)), Data: removed}
+		return printResponse(cmd, response, args, func(w io.Writer) {
+			fmt.Fprint(w, "Success: removed ")
+			fmt.Fprintln(w, strings.Join(args, ", "))
+		})
+	},
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:     "schedule",
+	Aliases: []string{"scheduler"},
+	Short:   "All commands related to the jobs scheduled with job schedule",
+	Long: `List and remove the jobs scheduled with job schedule, and run the scheduler
+that launches them. The command is also named scheduler, e.g.
+
+  cloud scheduler run`,
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Launch the scheduled jobs at their time",
+	Long: `Run in the foreground and launch the jobs scheduled with job schedule on the
+current manager when their time comes, until Ctrl-C. The schedules are read
+again every --poll-interval, so jobs scheduled meanwhile are picked up.
+
+Every launch is printed on stderr and recorded in the schedule, see schedule
+ls, and in the history, see job history. A job whose time passed while no
+scheduler was running is launched once when the scheduler starts. A job
+scheduled --at a time is tried again, up to 5 times and a minute later then
+twice as long every time, when the manager could not be reached before it got
+the job or answered that it is busy. Only one scheduler should run for a
+manager.
+
+--once launches the jobs due and exits, e.g. to be run every minute by the
+system cron.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if schedulerInterval <= 0 {
+			return badInputf("--poll-interval must be positive")
+		}
+		store, err := scheduleStore()
+		if err != nil {
+			return err
+		}
+		stderr := cmd.ErrOrStderr()
+
+		// Run until Ctrl-C, cobra may keep the context of a previous execution
+		// on subcommands
+		ctx := cmd.Root().Context()
+		if !schedulerOnce {
+			fmt.Fprintf(stderr, "Scheduler running for %s, stop it with Ctrl-C\n", ManagerEp)
+		}
+		failed := 0
+		var last error
+		for first := true; ; first = false {
+			next, errs, err := launchDue(cmd, store, time.Now(), first)
+			if err != nil {
+				return fmt.Errorf("could not update the schedules: %w", err)
+			}
+			if len(errs) > 0 {
+				failed += len(errs)
+				last = errs[len(errs)-1]
+			}
+			if schedulerOnce {
+				break
+			}
+
+			wait := schedulerInterval
+			if next != nil && time.Until(*next) > 0 && time.Until(*next) < wait {
+				wait = time.Until(*next)
+			}
+			select {
+			case <-ctx.Done():
+				fmt.Fprintln(stderr, "Scheduler stopped")
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("could not launch %d jobs, the last error: %w", failed, last)
+		}
+		return nil
+	},
+}
+
+// launchDue launches the jobs of the store due at now and records their
+// runs. A job launched once that failed is due again. It returns when the
+// next job is due, if any, and the errors of the launches that failed. The
+// first time, the schedules of other managers are reported.
+func launchDue(cmd *cobra.Command, store *schedule.Store, now time.Time, first bool) (*time.Time, []error, error) {
+	f, err := store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	others := 0
+	anyDue := false
+	for _, entry := range f.Entries {
+		if entry.Manager != ManagerEp {
+			others++
+		} else if entry.Due(now) {
+			anyDue = true
+		}
+	}
+	if first && others > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d schedules are for other managers, they are left to their scheduler\n", others)
+	}
+
+	// Claim the jobs due, another scheduler would not launch them again
+	var due []schedule.Entry
+	if anyDue {
+		err = store.Update(func(f *schedule.File) error {
+			due = nil
+			for _, entry := range f.Entries {
+				if entry.Manager == ManagerEp && entry.Due(now) {
+					due = append(due, *entry)
+					err := entry.Advance(now)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Launch them
+	scripts, err := historyStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	var failed []error
+	for i := range due {
+		entry := &due[i]
+		run := schedule.Run{Time: time.Now()}
+		script, err := scripts.OpenScript(entry.Sha256)
+		if err == nil {
+			script.Close()
+			result := launchOne(cmd, launchSpec{name: entry.Name, script: entry.Script, filename: entry.Filename, sha256: entry.Sha256, jobSpec: entry.Spec})
+			run.Id, err = result.Id, result.err
+		} else {
+			err = fmt.Errorf("the script of %s is no longer kept: %w", entry.Id, err)
+		}
+		launchErr := err
+		var retry *time.Time
+		if launchErr != nil {
+			run.Error = launchErr.Error()
+			failed = append(failed, launchErr)
+		}
+
+		err = store.Update(func(f *schedule.File) error {
+			if entry := f.Find(entry.Id); entry != nil {
+				entry.AddRun(run)
+				if launchErr != nil && retryable(launchErr) && entry.Retry(run.Time) {
+					retry = entry.Next
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stamp := run.Time.Format(time.RFC3339)
+		switch {
+		case launchErr == nil:
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s %s launched %s as %s\n", stamp, entry.Id, entry.Name, run.Id)
+		case retry != nil:
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s %s could not launch %s, trying again at %s: %v\n", stamp, entry.Id, entry.Name, formatTime(retry), launchErr)
+		default:
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s %s could not launch %s: %v\n", stamp, entry.Id, entry.Name, launchErr)
+		}
+	}
+
+	// Find when to look again
+	f, err = store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	var next *time.Time
+	for _, entry := range f.Entries {
+		if entry.Manager == ManagerEp && entry.Next != nil && (next == nil || entry.Next.Before(*next)) {
+			next = entry.Next
+		}
+	}
+	return next, failed, nil
+}
+
+// retryable reports whether a launch that failed with err can be tried again
+// without risking a second job: the manager never got it, or answered that it
+// is busy.
+func retryable(err error) bool {
+	var e *client.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Kind {
+	case client.KindUnreachable, client.KindTimeout:
+		return !e.MayHaveApplied
+	case client.KindServer, client.KindStatus:
+		return e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// parseAt parses the time of --at: a time with a date, with or without a
+// time zone, a time of day for the next time it comes, or a duration from now
+// such as +2h. The time must be in the future.
+func parseAt(value string, now time.Time) (time.Time, error) {
+	var at time.Time
+	if strings.HasPrefix(value, "+") {
+		d, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return at, badInputf("bad --at %q: %v", value, err)
+		}
+		at = now.Add(d)
+	} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+		at = t
+	} else {
+		for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "15:04:05", "15:04"} {
+			t, err := time.ParseInLocation(layout, value, time.Local)
+			if err != nil {
+				continue
+			}
+			if !strings.Contains(layout, "2006") {
+				// A time of day, today or tomorrow
+				t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+				if !t.After(now) {
+					t = t.AddDate(0, 0, 1)
+				}
+			}
+			at = t
+			break
+		}
+		if at.IsZero() {
+			return at, badInputf("bad --at %q, expected e.g. 2024-05-01 18:30, 18:30 or +2h", value)
+		}
+	}
+
+	if !at.After(now) {
+		return at, badInputf("--at %s is in the past", value)
+	}
+	return at, nil
+}
+
+// scheduleStore returns the schedules, kept in the directory of the config
+// file.
+func scheduleStore() (*schedule.Store, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	return schedule.Open(filepath.Join(filepath.Dir(path), "schedule")), nil
+}
+
+func init() {
+	jobCmd.AddCommand(jobScheduleCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+	scheduleCmd.AddCommand(scheduleLsCmd)
+	scheduleCmd.AddCommand(scheduleRmCmd)
+
+	// Launching uploads the script
+	setTimeout(scheduleRunCmd, 2*time.Minute)
+
+	jobScheduleCmd.Flags().StringVar(&scheduleAt, "at", "", "launch the job once at this time, e.g. 2024-05-01 18:30, 18:30 or +2h")
+	jobScheduleCmd.Flags().StringVar(&scheduleCron, "cron", "", "launch the job every time this cron expression matches, e.g. \"0 2 * * *\"")
+	addSpecFlags(jobScheduleCmd)
+
+	addTableFlags(scheduleLsCmd)
+
+	scheduleRunCmd.Flags().BoolVar(&schedulerOnce, "once", false, "launch the jobs due and exit")
+	scheduleRunCmd.Flags().DurationVar(&schedulerInterval, "poll-interval", 10*time.Second, "how often to read the schedules again")
+}
@@ -4,42 +4,15 @@ Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"io"
+	"time"
+
+	"awsonbudget/cli/client"
 
 	"github.com/spf13/cobra"
 )
 
-var serverEp string = "/cloud/server/"
-
-type serverLaunchResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		NodeId string `json:"node_id"`
-		Port   int    `json:"port"`
-	} `json:"data"`
-}
-
-type serverResumeResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		NodeId string `json:"node_id"`
-		Port   int    `json:"port"`
-	} `json:"data"`
-}
-
-type serverPauseResp struct {
-	Status bool   `json:"status"`
-	Msg    string `json:"msg"`
-	Data   []struct {
-		NodeId string `json:"node_id"`
-		Port   int    `json:"port"`
-	} `json:"data"`
-}
-
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "All commands related to server",
@@ -49,43 +22,15 @@ var serverLaunchCmd = &cobra.Command{
 	Use:   "launch [pod_id]",
 	Short: "Launch all server nodes in a pod given the pod id",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+serverEp+"launch/", nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().LaunchServers(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response serverLaunchResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-			for _, node := range response.Data {
-				fmt.Printf("| NodeId: %s |\n| Port: %d\n",
-					node.NodeId, node.Port)
-			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printServers(cmd, response)
 	},
 }
 
@@ -93,43 +38,15 @@ var serverResumeCmd = &cobra.Command{
 	Use:   "resume [pod_id]",
 	Short: "Resume all server nodes in a pod given the pod id",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+serverEp+"resume/", nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response serverResumeResp
-		err = json.NewDecoder(res.Body).Decode(&response)
+		response, err := manager().ResumeServers(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-			for _, node := range response.Data {
-				fmt.Printf("| NodeId: %s |\n| Port: %d\n",
-					node.NodeId, node.Port)
-			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printServers(cmd, response)
 	},
 }
 
@@ -137,52 +54,43 @@ var serverPauseCmd = &cobra.Command{
 	Use:   "pause [pod_id]",
 	Short: "Pause all server nodes in a pod given the pod id",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// Build the request
-		req, err := http.NewRequest(http.MethodPost, ManagerEp+serverEp+"pause/", nil)
-		if err != nil {
-			panic(err)
-		}
-
-		params := req.URL.Query()
-		params.Add("pod_id", args[0])
-		req.URL.RawQuery = params.Encode()
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Send the request
-		res, err := Client.Do(req)
+		response, err := manager().PauseServers(cmd.Context(), args[0])
 		if err != nil {
-			panic(err)
-		}
-		defer res.Body.Close()
-
-		// Decode the response
-		var response serverPauseResp
-		err = json.NewDecoder(res.Body).Decode(&response)
-		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Print the response
-		if response.Status {
-			fmt.Print("Success: ")
-			fmt.Println(response.Msg)
-			for _, node := range response.Data {
-				fmt.Printf("| NodeId: %s |\n| Port: %d\n",
-					node.NodeId, node.Port)
-			}
-		} else {
-			fmt.Print("Failed: ")
-			fmt.Println(response.Msg)
-		}
+		return printServers(cmd, response)
 	},
 }
 
+// printServers prints the server nodes returned by launch, pause and resume.
+func printServers(cmd *cobra.Command, response *client.ServerResponse) error {
+	var ids []string
+	for _, node := range response.Data {
+		ids = append(ids, node.NodeId)
+	}
+	return printResponse(cmd, response, ids, func(w io.Writer) {
+		fmt.Fprint(w, "Success: ")
+		fmt.Fprintln(w, response.Msg)
+		for _, node := range response.Data {
+			fmt.Fprintf(w, "| NodeId: %s |\n| Port: %d\n",
+				node.NodeId, node.Port)
+		}
+	})
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.AddCommand(serverLaunchCmd)
 	serverCmd.AddCommand(serverPauseCmd)
 	serverCmd.AddCommand(serverResumeCmd)
 
+	// Launching starts every server node of the pod
+	setTimeout(serverLaunchCmd, 2*time.Minute)
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,159 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+// Flags of job launch for the job spec.
+var (
+	launchEnv        []string
+	launchEnvFile    string
+	launchCPU        float64
+	launchMemory     string
+	launchJobTimeout time.Duration
+)
+
+// addSpecFlags adds the flags of the job spec to cmd.
+func addSpecFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&launchEnv, "env", "e", nil, "environment variable of the script, KEY=VALUE, can be repeated")
+	cmd.Flags().StringVar(&launchEnvFile, "env-file", "", "file of environment variables of the script, a KEY=VALUE per line")
+	cmd.Flags().Float64Var(&launchCPU, "cpu", 0, "cores the job needs, e.g. 0.5")
+	cmd.Flags().StringVar(&launchMemory, "memory", "", "memory the job needs, e.g. 512MB")
+	cmd.Flags().DurationVar(&launchJobTimeout, "job-timeout", 0, "how long the job may run before it is stopped, e.g. 1h")
+}
+
+// splitArgs splits the arguments of job launch into those of the command and
+// those after --, which are passed to the script.
+func splitArgs(cmd *cobra.Command, args []string) ([]string, []string) {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 {
+		return args, nil
+	}
+	return args[:dash], args[dash:]
+}
+
+// jobSpec returns the spec of the jobs launched with scriptArgs, or nil if
+// no spec flag was given.
+func jobSpec(scriptArgs []string) (*client.JobSpec, error) {
+	spec := &client.JobSpec{Args: scriptArgs}
+
+	// --env overrides --env-file
+	if launchEnvFile != "" {
+		env, err := godotenv.Read(launchEnvFile)
+		if err != nil {
+			return nil, badInputf("could not read %s: %v", launchEnvFile, err)
+		}
+		spec.Env = env
+	}
+	for _, pair := range launchEnv {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, badInputf("bad --env %q, expected KEY=VALUE", pair)
+		}
+		if spec.Env == nil {
+			spec.Env = map[string]string{}
+		}
+		spec.Env[key] = value
+	}
+
+	if launchCPU < 0 {
+		return nil, badInputf("--cpu cannot be negative")
+	}
+	spec.CPU = launchCPU
+	if launchMemory != "" {
+		memory, err := parseSize(launchMemory)
+		if err != nil {
+			return nil, err
+		}
+		spec.Memory = memory
+	}
+	if launchJobTimeout < 0 {
+		return nil, badInputf("--job-timeout cannot be negative")
+	}
+	if launchJobTimeout%time.Second != 0 {
+		return nil, badInputf("--job-timeout is counted in whole seconds")
+	}
+	spec.Timeout = int64(launchJobTimeout / time.Second)
+
+	if len(spec.Env) == 0 && len(spec.Args) == 0 && spec.CPU == 0 && spec.Memory == 0 && spec.Timeout == 0 {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// specLines returns the fields of spec as label and value pairs, for the
+// table output. Fields left to the manager are skipped.
+func specLines(spec *client.JobSpec) [][2]string {
+	if spec == nil {
+		return nil
+	}
+
+	var lines [][2]string
+	if len(spec.Args) > 0 {
+		lines = append(lines, [2]string{"Args", quoteArgs(spec.Args)})
+	}
+	keys := make([]string, 0, len(spec.Env))
+	for key := range spec.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		label := ""
+		if i == 0 {
+			label = "Env"
+		}
+		lines = append(lines, [2]string{label, key + "=" + spec.Env[key]})
+	}
+	if spec.CPU > 0 {
+		lines = append(lines, [2]string{"CPU", strconv.FormatFloat(spec.CPU, 'f', -1, 64)})
+	}
+	if spec.Memory > 0 {
+		lines = append(lines, [2]string{"Memory", formatSize(spec.Memory)})
+	}
+	if spec.Timeout > 0 {
+		lines = append(lines, [2]string{"Timeout", (time.Duration(spec.Timeout) * time.Second).String()})
+	}
+	return lines
+}
+
+// quoteArgs joins args as they would be typed in a shell.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?&|;<>()#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// printFields prints label and value pairs, aligned.
+func printFields(w io.Writer, lines [][2]string) {
+	width := 0
+	for _, line := range lines {
+		if len(line[0]) > width {
+			width = len(line[0])
+		}
+	}
+	for _, line := range lines {
+		label := line[0]
+		if label != "" {
+			label += ":"
+		}
+		fmt.Fprintf(w, "%-*s %s\n", width+1, label, line[1])
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags of job sweep.
+var (
+	sweepParams     []string
+	sweepParamsFile string
+	sweepRecordFile string
+	sweepForce      bool
+	sweepDryRun     bool
+)
+
+// params is a combination of parameters of a sweep.
+type params map[string]string
+
+// sweepJob is a job of a sweep, as recorded in the sweep file.
+type sweepJob struct {
+	Index  int    `json:"index" yaml:"index"`
+	Name   string `json:"name" yaml:"name"`
+	Params params `json:"params" yaml:"params"`
+	Id     string `json:"job_id,omitempty" yaml:"job_id,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// sweepRecord is what the sweep file holds, to find the job of a combination
+// later on.
+type sweepRecord struct {
+	Name     string     `json:"name"`
+	Template string     `json:"template"`
+	Manager  string     `json:"manager"`
+	Launched time.Time  `json:"launched"`
+	Jobs     []sweepJob `json:"jobs"`
+}
+
+var jobSweepCmd = &cobra.Command{
+	Use:   "sweep [name] [script_template]",
+	Short: "Launch a job per combination of parameters of a script template",
+	Long: `Launch a job per combination of parameters of a script template.
+
+The template is a Go text/template where every parameter is a field, e.g.
+{{.lr}}. The combinations are the product of the values of every --param,
+e.g. --param lr=0.1,0.01 --param depth=2,4 gives 4 jobs, and of the rows of
+--params-file. A CSV file has a header row of parameter names and a
+combination per row. A YAML file is either a list of combinations or a
+mapping of parameter names to lists of values, which are combined like
+--param.
+
+The jobs are named <name>-1 to <name>-<count> and the mapping of every
+combination to its job id is written to --record, <name>.sweep.json by
+default, which is not overwritten unless --force is given. Nothing is
+recorded if no job was launched. --dry-run prints
+the combinations without launching anything.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, templatePath := args[0], args[1]
+		if launchParallel < 1 {
+			return badInputf("--parallel must be at least 1")
+		}
+
+		// Build the combinations
+		keys, combinations, err := sweepCombinations()
+		if err != nil {
+			return err
+		}
+
+		// Render the scripts
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return badInput(err)
+		}
+		tmpl, err := template.New(filepath.Base(templatePath)).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return badInputf("could not parse %s: %v", templatePath, err)
+		}
+		filename := strings.TrimSuffix(filepath.Base(templatePath), ".tmpl")
+
+		jobs := make([]sweepJob, len(combinations))
+		specs := make([]launchSpec, len(combinations))
+		for i, combination := range combinations {
+			var rendered bytes.Buffer
+			err = tmpl.Execute(&rendered, combination)
+			if err != nil {
+				return badInputf("could not render %s with %s: %v", templatePath, formatParams(keys, combination), err)
+			}
+			jobs[i] = sweepJob{Index: i + 1, Name: name + "-" + strconv.Itoa(i+1), Params: combination}
+			specs[i] = launchSpec{name: jobs[i].Name, script: templatePath, filename: filename, content: rendered.Bytes()}
+		}
+
+		// Check the record can be written before launching anything
+		path := sweepRecordFile
+		if path == "" {
+			path = name + ".sweep.json"
+		}
+		if _, err := os.Stat(path); err == nil && !sweepForce && !sweepDryRun {
+			return badInputf("%s already exists, give another --record or --force to overwrite it", path)
+		}
+
+		// Send the requests
+		var failed []error
+		if !sweepDryRun {
+			results := launchAll(cmd, specs)
+			for i, result := range results {
+				jobs[i].Id, jobs[i].Error = result.Id, result.Error
+				if result.err != nil {
+					failed = append(failed, result.err)
+				}
+			}
+		}
+
+		// Print the response
+		var ids []string
+		for _, job := range jobs {
+			if job.Id != "" {
+				ids = append(ids, job.Id)
+			}
+		}
+		response := &cliResponse[[]sweepJob]{
+			Status: len(failed) == 0,
+			Msg:    fmt.Sprintf("launched %d of %d jobs", len(ids), len(jobs)),
+			Data:   jobs,
+		}
+		if sweepDryRun {
+			response.Msg = fmt.Sprintf("dry run, %d jobs would be launched", len(jobs))
+		}
+		err = printResponse(cmd, response, ids, func(w io.Writer) {
+			t := newTable("NAME", "JOB ID", "PARAMS", "ERROR")
+			for _, job := range jobs {
+				t.addRow(job.Name, job.Id, formatParams(keys, job.Params), job.Error)
+			}
+			t.render(w)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Record the jobs once their ids are printed, if any was launched
+		var recordErr error
+		if len(ids) > 0 {
+			record := &sweepRecord{Name: name, Template: templatePath, Manager: ManagerEp, Launched: time.Now(), Jobs: jobs}
+			recordErr = writeSweepRecord(path, record)
+			if recordErr != nil {
+				recordErr = fmt.Errorf("could not record the sweep in %s: %w", path, recordErr)
+			} else {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Recorded the jobs in %s\n", path)
+			}
+		}
+
+		if len(failed) > 0 {
+			if recordErr != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v\n", recordErr)
+			}
+			return fmt.Errorf("could not launch %d of %d jobs, the first error: %w", len(failed), len(jobs), failed[0])
+		}
+		return recordErr
+	},
+}
+
+// sweepCombinations returns the parameter names, in the order they were
+// given, and every combination of --params-file and --param.
+func sweepCombinations() ([]string, []params, error) {
+	keys := []string{}
+	combinations := []params{{}}
+
+	// cross combines every combination so far with every row of a dimension
+	cross := func(dimKeys []string, rows []params) error {
+		for _, key := range dimKeys {
+			for _, known := range keys {
+				if key == known {
+					return badInputf("parameter %q is given twice", key)
+				}
+			}
+		}
+		if len(rows) == 0 {
+			return badInputf("parameter %s has no values", strings.Join(dimKeys, ", "))
+		}
+		keys = append(keys, dimKeys...)
+
+		var crossed []params
+		for _, combination := range combinations {
+			for _, row := range rows {
+				merged := params{}
+				for k, v := range combination {
+					merged[k] = v
+				}
+				for k, v := range row {
+					merged[k] = v
+				}
+				crossed = append(crossed, merged)
+			}
+		}
+		combinations = crossed
+		return nil
+	}
+
+	if sweepParamsFile != "" {
+		dimensions, err := readParamsFile(sweepParamsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dim := range dimensions {
+			err = cross(dim.keys, dim.rows)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for _, param := range sweepParams {
+		key, values, ok := strings.Cut(param, "=")
+		if !ok || key == "" || values == "" {
+			return nil, nil, badInputf("bad --param %q, expected name=value1,value2", param)
+		}
+		dim := paramValues(key, strings.Split(values, ","))
+		err := cross(dim.keys, dim.rows)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil, badInputf("no parameters, give some with --param or --params-file")
+	}
+	return keys, combinations, nil
+}
+
+// dimension is a set of rows of parameters combined with every other one.
+type dimension struct {
+	keys []string
+	rows []params
+}
+
+// paramValues returns the dimension of a single parameter.
+func paramValues(key string, values []string) dimension {
+	dim := dimension{keys: []string{key}}
+	for _, value := range values {
+		dim.rows = append(dim.rows, params{key: value})
+	}
+	return dim
+}
+
+// readParamsFile reads the dimensions of a CSV or YAML parameters file.
+func readParamsFile(path string) ([]dimension, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, badInput(err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, badInputf("could not parse %s: %v", path, err)
+		}
+		if len(records) < 2 {
+			return nil, badInputf("%s needs a header row and at least one combination", path)
+		}
+		dim := dimension{keys: records[0]}
+		for _, record := range records[1:] {
+			row := params{}
+			for i, key := range dim.keys {
+				row[key] = record[i]
+			}
+			dim.rows = append(dim.rows, row)
+		}
+		return []dimension{dim}, nil
+
+	case ".yaml", ".yml":
+		var node yaml.Node
+		err = yaml.Unmarshal(data, &node)
+		if err != nil || len(node.Content) == 0 {
+			return nil, badInputf("could not parse %s: %v", path, err)
+		}
+		root := node.Content[0]
+
+		// A list of combinations
+		if root.Kind == yaml.SequenceNode {
+			var rows []params
+			err = root.Decode(&rows)
+			if err != nil || len(rows) == 0 {
+				return nil, badInputf("%s must be a list of combinations: %v", path, err)
+			}
+			dim := dimension{rows: rows}
+			for i := 0; i < len(root.Content[0].Content); i += 2 {
+				dim.keys = append(dim.keys, root.Content[0].Content[i].Value)
+			}
+			return []dimension{dim}, nil
+		}
+
+		// A mapping of parameter names to values, in the order of the file
+		if root.Kind != yaml.MappingNode {
+			return nil, badInputf("%s must be a list of combinations or a mapping of parameters to values", path)
+		}
+		var dimensions []dimension
+		for i := 0; i < len(root.Content); i += 2 {
+			var values []string
+			err = root.Content[i+1].Decode(&values)
+			if err != nil {
+				return nil, badInputf("%s: parameter %s must be a list of values: %v", path, root.Content[i].Value, err)
+			}
+			dimensions = append(dimensions, paramValues(root.Content[i].Value, values))
+		}
+		return dimensions, nil
+
+	default:
+		return nil, badInputf("%s must be a .csv, .yaml or .yml file", path)
+	}
+}
+
+// formatParams returns p as name=value pairs, in the order of keys.
+func formatParams(keys []string, p params) string {
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+p[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// writeSweepRecord writes record to the file at path.
+func writeSweepRecord(path string, record *sweepRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func init() {
+	jobCmd.AddCommand(jobSweepCmd)
+
+	// Every job uploads a script
+	setTimeout(jobSweepCmd, 2*time.Minute)
+
+	jobSweepCmd.Flags().StringArrayVar(&sweepParams, "param", nil, "a parameter and its values, e.g. lr=0.1,0.01, can be repeated")
+	jobSweepCmd.Flags().StringVar(&sweepParamsFile, "params-file", "", "CSV or YAML file of parameters")
+	jobSweepCmd.Flags().StringVar(&sweepRecordFile, "record", "", "file to record the job of every combination in (default <name>.sweep.json)")
+	jobSweepCmd.Flags().BoolVar(&sweepForce, "force", false, "overwrite the --record file if it exists")
+	jobSweepCmd.Flags().BoolVar(&sweepDryRun, "dry-run", false, "print the combinations without launching anything")
+	jobSweepCmd.Flags().IntVar(&launchParallel, "parallel", 4, "how many jobs to launch at a time")
+}
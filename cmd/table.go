@@ -0,0 +1,137 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Flags shared by every list command.
+var (
+	noHeaders bool
+	wide      bool
+)
+
+const (
+	// columnGap is the space between two columns
+	columnGap = 3
+	// minColumnWidth is the narrowest a column gets truncated to
+	minColumnWidth = 6
+)
+
+// table is a set of rows printed with aligned columns.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func newTable(headers ...string) *table {
+	return &table{headers: headers}
+}
+
+func (t *table) addRow(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// addTableFlags adds the flags controlling the table output to a list command.
+func addTableFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "don't print the column headers")
+	cmd.Flags().BoolVar(&wide, "wide", false, "print extra columns and never truncate them")
+}
+
+// render writes the table to w. When w is a terminal and --wide is not set,
+// columns are truncated so that every row fits on a single line. The first
+// column holds ids and is never truncated.
+func (t *table) render(w io.Writer) {
+	rows := t.rows
+	if !noHeaders {
+		rows = append([][]string{t.headers}, rows...)
+	}
+
+	widths := make([]int, len(t.headers))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if !wide {
+		shrink(widths, terminalWidth(w))
+	}
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line.WriteString(truncate(cell, widths[i]))
+				break
+			}
+			fmt.Fprintf(&line, "%-*s", widths[i]+columnGap, truncate(cell, widths[i]))
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+}
+
+// shrink narrows the widest columns, except the first one, until the table
+// fits in limit characters. A limit of 0 means there is no limit.
+func shrink(widths []int, limit int) {
+	if limit <= 0 {
+		return
+	}
+
+	total := columnGap * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+	}
+
+	for total > limit {
+		widest := 0
+		for i := 1; i < len(widths); i++ {
+			if widths[i] > minColumnWidth && (widest == 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest == 0 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// truncate cuts cell to width characters, marking the cut with an ellipsis.
+func truncate(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	runes := []rune(cell)
+	return string(runes[:width-1]) + "…"
+}
+
+// terminalWidth returns the width of the terminal w writes to, or 0 if w is
+// not a terminal.
+func terminalWidth(w io.Writer) int {
+	if !isTerminal(w) {
+		return 0
+	}
+	width, _, err := term.GetSize(int(w.(*os.File).Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// isTerminal reports whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
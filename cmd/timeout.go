@@ -0,0 +1,65 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultTimeout bounds every call to the manager unless the command sets its
+// own default with setTimeout or the user passes --timeout.
+const defaultTimeout = 30 * time.Second
+
+var timeout time.Duration
+
+// commandTimeouts holds the default timeout of the commands known to be slow.
+var commandTimeouts = map[*cobra.Command]time.Duration{}
+
+// cancelTimeout releases the timer started by applyTimeout.
+var cancelTimeout context.CancelFunc = func() {}
+
+// setTimeout sets the default timeout of cmd.
+func setTimeout(cmd *cobra.Command, d time.Duration) {
+	commandTimeouts[cmd] = d
+}
+
+// applyTimeout bounds the context of cmd with --timeout, or with the default
+// timeout of cmd. An explicit --timeout 0 disables the timeout.
+func applyTimeout(cmd *cobra.Command) {
+	d, ok := commandTimeouts[cmd]
+	if !ok {
+		d = defaultTimeout
+	}
+	if cmd.Flags().Changed("timeout") {
+		d = timeout
+	}
+
+	// Start from the context given to the root command, cobra keeps the one
+	// of a previous execution on subcommands
+	ctx := cmd.Root().Context()
+	if d > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, d)
+	}
+	cmd.SetContext(ctx)
+}
+
+// requestContext returns a context for a single request of a command that
+// sends many and runs longer than its timeout, e.g. while waiting for a job to
+// end. The request is bounded by --timeout, or by the default timeout of cmd.
+func requestContext(ctx context.Context, cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	d, ok := commandTimeouts[cmd]
+	if !ok {
+		d = defaultTimeout
+	}
+	if cmd.Flags().Changed("timeout") {
+		d = timeout
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Job statuses reported by the manager once a job is over.
+const (
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobAborted   = "aborted"
+)
+
+// spinInterval is how often the progress spinner moves.
+const spinInterval = 200 * time.Millisecond
+
+var spinner = []rune(`|/-\`)
+
+// Flags of the commands that wait for jobs.
+var (
+	waitTimeout  time.Duration
+	pollInterval time.Duration
+)
+
+// addWaitFlags adds the flags that control how long and how often cmd polls
+// the manager.
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 0, "how long to wait for the job to end, 0 to wait forever")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", 2*time.Second, "how often to ask the manager for the job status")
+}
+
+// finished reports whether a job with status is over.
+func finished(status string) bool {
+	return status == jobCompleted || status == jobFailed || status == jobAborted
+}
+
+// jobResult returns nil if job completed, or the error to exit with.
+func jobResult(job *client.Job) error {
+	if job.Status == jobCompleted {
+		return nil
+	}
+	return &jobError{id: job.Id, status: job.Status}
+}
+
+// waitJob polls the manager until the job with id is over and returns its
+// last state. The progress is shown on stderr.
+func waitJob(cmd *cobra.Command, id string) (*client.Job, error) {
+	ctx := cmd.Root().Context()
+	if waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
+	}
+
+	var status, text string
+	p := newProgress(cmd.ErrOrStderr(), func(p *progress) []string {
+		if text == "" {
+			return nil
+		}
+		if !p.tty {
+			return []string{text}
+		}
+		return []string{fmt.Sprintf("%c %s (%s)", p.mark(), text, p.elapsed())}
+	})
+	defer p.clear()
+
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+	spin := time.NewTicker(spinInterval)
+	defer spin.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, &waitError{
+				id:          id,
+				status:      status,
+				after:       time.Since(p.start),
+				interrupted: !errors.Is(ctx.Err(), context.DeadlineExceeded),
+			}
+
+		case <-spin.C:
+			p.spin()
+
+		case <-poll.C:
+			job, err := findJob(ctx, cmd, id)
+			if err != nil && ctx.Err() != nil {
+				// Reported as a waitError by the next iteration
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			status, text = job.Status, fmt.Sprintf("job %s %s", job.Id, job.Status)
+			if job.Node != "" {
+				text += " on " + job.Node
+			}
+			p.update()
+			if finished(job.Status) {
+				return job, nil
+			}
+			poll.Reset(pollInterval)
+		}
+	}
+}
+
+// findJob returns the job with id as listed by the manager.
+func findJob(ctx context.Context, cmd *cobra.Command, id string) (*client.Job, error) {
+	ctx, cancel := requestContext(ctx, cmd)
+	defer cancel()
+
+	response, err := manager().ListJobs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range response.Data {
+		if response.Data[i].Id == id {
+			return &response.Data[i], nil
+		}
+	}
+	return nil, &client.Error{Kind: client.KindNotFound, Msg: "job " + id + " is not listed by the manager"}
+}
+
+// progress shows what we are waiting for, as the lines returned by render. On
+// a terminal the lines are redrawn with a spinner and the elapsed time,
+// elsewhere a line is printed every time it changes.
+type progress struct {
+	w      io.Writer
+	tty    bool
+	start  time.Time
+	frame  int
+	render func(p *progress) []string
+	// shown are the lines last printed or drawn
+	shown []string
+	drawn int
+}
+
+func newProgress(w io.Writer, render func(p *progress) []string) *progress {
+	return &progress{w: w, tty: isTerminal(w), start: time.Now(), render: render}
+}
+
+// mark is the current frame of the spinner.
+func (p *progress) mark() rune {
+	return spinner[p.frame%len(spinner)]
+}
+
+// elapsed is the time since the progress started, to the second.
+func (p *progress) elapsed() time.Duration {
+	return time.Since(p.start).Round(time.Second)
+}
+
+// update shows the lines as they are now.
+func (p *progress) update() {
+	lines := p.render(p)
+	if p.tty {
+		p.draw(lines)
+		return
+	}
+	for i, line := range lines {
+		if i >= len(p.shown) || p.shown[i] != line {
+			fmt.Fprintln(p.w, line)
+		}
+	}
+	p.shown = lines
+}
+
+// spin moves the spinner.
+func (p *progress) spin() {
+	if p.tty && p.drawn > 0 {
+		p.frame++
+		p.draw(p.render(p))
+	}
+}
+
+func (p *progress) draw(lines []string) {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.w, "\033[%dA", p.drawn)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(p.w, "\r\033[K%s\n", line)
+	}
+	if len(lines) < p.drawn {
+		fmt.Fprint(p.w, "\r\033[J")
+	}
+	p.drawn = len(lines)
+}
+
+// clear removes the lines drawn from the terminal.
+func (p *progress) clear() {
+	if p.tty && p.drawn > 0 {
+		fmt.Fprintf(p.w, "\033[%dA\r\033[J", p.drawn)
+		p.drawn = 0
+	}
+}
@@ -0,0 +1,558 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"awsonbudget/cli/client"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags of workflow run.
+var (
+	workflowOnFailure string
+	workflowDryRun    bool
+)
+
+// Failure policies of a workflow.
+const (
+	// onFailureHalt launches no more jobs once a job failed
+	onFailureHalt = "halt"
+	// onFailureContinue only skips the jobs that depend on a failed job
+	onFailureContinue = "continue"
+)
+
+// Statuses of the jobs of a workflow that are not on the manager.
+const (
+	stepPending     = "pending"
+	stepSkipped     = "skipped"
+	stepNotLaunched = "not launched"
+	stepNotFound    = "not found"
+)
+
+// workflowFile is the content of a workflow file.
+type workflowFile struct {
+	Name      string         `yaml:"name"`
+	OnFailure string         `yaml:"on_failure"`
+	Jobs      []workflowStep `yaml:"jobs"`
+}
+
+// workflowStep is a job of a workflow file.
+type workflowStep struct {
+	Name      string            `yaml:"name"`
+	Script    string            `yaml:"script"`
+	DependsOn []string          `yaml:"depends_on"`
+	Args      []string          `yaml:"args"`
+	Env       map[string]string `yaml:"env"`
+	CPU       float64           `yaml:"cpu"`
+	Memory    string            `yaml:"memory"`
+	Timeout   time.Duration     `yaml:"timeout"`
+}
+
+// workflowJob is a job of a running workflow.
+type workflowJob struct {
+	Name      string   `json:"name" yaml:"name"`
+	Id        string   `json:"job_id,omitempty" yaml:"job_id,omitempty"`
+	Status    string   `json:"status" yaml:"status"`
+	Node      string   `json:"node,omitempty" yaml:"node,omitempty"`
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	// Stage is the length of the longest chain of dependencies of the job
+	Stage int    `json:"stage" yaml:"stage"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	spec  launchSpec
+	err   error
+	deps  []*workflowJob
+}
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "All commands related to workflows of jobs",
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run [workflow_file]",
+	Short: "Run the jobs of a workflow in the order of their dependencies",
+	Long: `Run the jobs of a workflow file, launching every job once the jobs it depends
+on completed. Scripts are relative to the workflow file, e.g.
+
+  name: pipeline
+  on_failure: halt
+  jobs:
+    - name: prepare
+      script: prepare.sh
+    - name: train
+      script: train.sh
+      depends_on: [prepare]
+      args: [--lr, "0.1"]
+      env: {EPOCHS: "10"}
+      cpu: 2
+      memory: 4GB
+      timeout: 1h
+    - name: report
+      script: report.sh
+      depends_on: [train]
+
+When a job fails, is aborted or cannot be launched, on_failure or --on-failure
+decides what happens: halt, the default, launches no more jobs and waits for
+those running, continue only skips the jobs that depend on it.
+
+The status of every job is shown on stderr while the workflow runs, the jobs are
+polled every --poll-interval. The exit code is 0 if every job completed, 10 if
+a job failed, 11 if one was aborted and 8 if the workflow did not end within
+--wait-timeout, the state of the jobs is printed in every case. A job the
+manager no longer lists ends as not found. --dry-run checks the workflow and
+prints its stages.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, policy, jobs, err := readWorkflow(args[0])
+		if err != nil {
+			return err
+		}
+		if workflowOnFailure != "" {
+			policy = workflowOnFailure
+		}
+		if policy != onFailureHalt && policy != onFailureContinue {
+			return badInputf("bad failure policy %q, expected halt or continue", policy)
+		}
+
+		// A workflow that did not end within --wait-timeout or was
+		// interrupted still prints the state of its jobs
+		var stopped *waitError
+		if !workflowDryRun {
+			err = runWorkflow(cmd, name, policy, jobs)
+			if err != nil && !errors.As(err, &stopped) {
+				return err
+			}
+		}
+
+		// Print the response
+		completed := 0
+		var ids []string
+		for _, job := range jobs {
+			if job.Status == jobCompleted {
+				completed++
+			}
+			if job.Id != "" {
+				ids = append(ids, job.Id)
+			}
+		}
+		response := &cliResponse[[]*workflowJob]{
+			Status: completed == len(jobs),
+			Msg:    fmt.Sprintf("workflow %s: %d of %d jobs completed", name, completed, len(jobs)),
+			Data:   jobs,
+		}
+		if workflowDryRun {
+			response.Status, response.Msg = true, fmt.Sprintf("dry run, workflow %s has %d jobs", name, len(jobs))
+		}
+		err = printResponse(cmd, response, ids, func(w io.Writer) {
+			headers := []string{"NAME", "STAGE", "DEPENDS ON", "JOB ID", "STATUS", "ERROR"}
+			if workflowDryRun {
+				headers = headers[:3]
+			}
+			t := newTable(headers...)
+			for _, job := range jobs {
+				row := []string{job.Name, fmt.Sprint(job.Stage), strings.Join(job.DependsOn, ", "), job.Id, job.Status, job.Error}
+				t.addRow(row[:len(headers)]...)
+			}
+			t.render(w)
+		})
+		if err != nil || workflowDryRun {
+			return err
+		}
+		if outputFormat == outputTable {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Workflow %s: %d of %d jobs completed\n", name, completed, len(jobs))
+		}
+		if stopped != nil {
+			return stopped
+		}
+		return workflowResult(name, jobs)
+	},
+}
+
+// readWorkflow reads the workflow file at path and returns its name, its
+// failure policy and its jobs in the order they can be launched.
+func readWorkflow(path string) (string, string, []*workflowJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", nil, badInput(err)
+	}
+
+	var file workflowFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&file)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", "", nil, badInputf("could not parse %s: %v", path, err)
+	}
+	if len(file.Jobs) == 0 {
+		return "", "", nil, badInputf("%s has no jobs", path)
+	}
+	if file.Name == "" {
+		file.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if file.OnFailure == "" {
+		file.OnFailure = onFailureHalt
+	}
+
+	// Check the jobs
+	byName := map[string]*workflowJob{}
+	var jobs []*workflowJob
+	for i, step := range file.Jobs {
+		switch {
+		case step.Name == "":
+			return "", "", nil, badInputf("%s: job %d has no name", path, i+1)
+		case step.Script == "":
+			return "", "", nil, badInputf("%s: job %s has no script", path, step.Name)
+		case byName[step.Name] != nil:
+			return "", "", nil, badInputf("%s: job %s is defined twice", path, step.Name)
+		}
+		spec, err := stepSpec(step)
+		if err != nil {
+			return "", "", nil, badInputf("%s: job %s: %v", path, step.Name, err)
+		}
+
+		script := step.Script
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(filepath.Dir(path), script)
+		}
+		if _, err := os.Stat(script); err != nil {
+			return "", "", nil, badInputf("%s: job %s: %v", path, step.Name, err)
+		}
+		job := &workflowJob{
+			Name:      step.Name,
+			Status:    stepPending,
+			DependsOn: step.DependsOn,
+			spec:      launchSpec{name: step.Name, script: script, jobSpec: spec},
+		}
+		byName[job.Name] = job
+		jobs = append(jobs, job)
+	}
+	for _, job := range jobs {
+		for _, dep := range job.DependsOn {
+			if byName[dep] == nil {
+				return "", "", nil, badInputf("%s: job %s depends on %s, which is not defined", path, job.Name, dep)
+			}
+			if dep == job.Name {
+				return "", "", nil, badInputf("%s: job %s depends on itself", path, job.Name)
+			}
+			job.deps = append(job.deps, byName[dep])
+		}
+	}
+
+	jobs, err = sortJobs(jobs)
+	if err != nil {
+		return "", "", nil, badInputf("%s: %v", path, err)
+	}
+	return file.Name, file.OnFailure, jobs, nil
+}
+
+// stepSpec returns the spec of the job of step, or nil if it has none.
+func stepSpec(step workflowStep) (*client.JobSpec, error) {
+	spec := &client.JobSpec{Env: step.Env, Args: step.Args, CPU: step.CPU}
+	if step.CPU < 0 {
+		return nil, errors.New("cpu cannot be negative")
+	}
+	if step.Memory != "" {
+		memory, err := parseSize(step.Memory)
+		if err != nil {
+			return nil, err
+		}
+		spec.Memory = memory
+	}
+	if step.Timeout < 0 || step.Timeout%time.Second != 0 {
+		return nil, errors.New("timeout must be a positive number of whole seconds")
+	}
+	spec.Timeout = int64(step.Timeout / time.Second)
+
+	if len(spec.Env) == 0 && len(spec.Args) == 0 && spec.CPU == 0 && spec.Memory == 0 && spec.Timeout == 0 {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// sortJobs returns jobs in an order where every job comes after those it
+// depends on, keeping the order of the file otherwise, and sets their stage.
+func sortJobs(jobs []*workflowJob) ([]*workflowJob, error) {
+	var sorted []*workflowJob
+	done := map[*workflowJob]bool{}
+	for len(sorted) < len(jobs) {
+		progressed := false
+		for _, job := range jobs {
+			if done[job] {
+				continue
+			}
+			ready := true
+			job.Stage = 0
+			for _, dep := range job.deps {
+				if !done[dep] {
+					ready = false
+					break
+				}
+				if dep.Stage+1 > job.Stage {
+					job.Stage = dep.Stage + 1
+				}
+			}
+			if ready {
+				sorted = append(sorted, job)
+				done[job] = true
+				progressed = true
+			}
+		}
+
+		if !progressed {
+			var cycle []string
+			for _, job := range jobs {
+				if !done[job] {
+					cycle = append(cycle, job.Name)
+				}
+			}
+			return nil, fmt.Errorf("the dependencies of %s make a cycle", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+// over reports whether job will not change anymore.
+func (job *workflowJob) over() bool {
+	return finished(job.Status) || job.Status == stepSkipped || job.Status == stepNotLaunched || job.Status == stepNotFound
+}
+
+// failed reports whether job is over without completing.
+func (job *workflowJob) failed() bool {
+	return job.over() && job.Status != jobCompleted
+}
+
+// runWorkflow launches the jobs of a workflow as their dependencies complete
+// and polls them until every job is over. The status of the jobs is shown on
+// stderr.
+func runWorkflow(cmd *cobra.Command, name, policy string, jobs []*workflowJob) error {
+	ctx := cmd.Root().Context()
+	if waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
+	}
+
+	view := workflowProgress(cmd.ErrOrStderr(), jobs)
+	defer view.clear()
+
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+	spin := time.NewTicker(spinInterval)
+	defer spin.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			var pending []string
+			id := ""
+			for _, job := range jobs {
+				if !job.over() && job.Id != "" {
+					pending = append(pending, job.Id)
+					if id == "" {
+						id = job.Id
+					}
+				}
+			}
+			status := "no job is running"
+			if len(pending) > 0 {
+				status = "jobs " + strings.Join(pending, ", ") + " are not over"
+			}
+			return &waitError{
+				id:          id,
+				status:      status,
+				after:       time.Since(view.start),
+				interrupted: !errors.Is(ctx.Err(), context.DeadlineExceeded),
+				workflow:    name,
+			}
+
+		case <-spin.C:
+			view.spin()
+
+		case <-poll.C:
+			err := refreshJobs(ctx, cmd, jobs)
+			if err != nil && ctx.Err() != nil {
+				// Reported as a waitError by the next iteration
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			launchReady(ctx, cmd, policy, jobs)
+			view.update()
+
+			over := true
+			for _, job := range jobs {
+				over = over && job.over()
+			}
+			if over {
+				return nil
+			}
+			poll.Reset(pollInterval)
+		}
+	}
+}
+
+// refreshJobs updates the status of the jobs launched that are not over. A job
+// the manager no longer lists is over as not found.
+func refreshJobs(ctx context.Context, cmd *cobra.Command, jobs []*workflowJob) error {
+	running := map[string]*workflowJob{}
+	for _, job := range jobs {
+		if job.Id != "" && !job.over() {
+			running[job.Id] = job
+		}
+	}
+	if len(running) == 0 {
+		return nil
+	}
+
+	ctx, cancel := requestContext(ctx, cmd)
+	defer cancel()
+	response, err := manager().ListJobs(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, listed := range response.Data {
+		if job := running[listed.Id]; job != nil {
+			job.Status, job.Node = listed.Status, listed.Node
+			delete(running, listed.Id)
+		}
+	}
+	for id, job := range running {
+		job.err = &client.Error{Kind: client.KindNotFound, Msg: "job " + id + " is not listed by the manager"}
+		job.Status, job.Error = stepNotFound, job.err.Error()
+	}
+	return nil
+}
+
+// launchReady skips the jobs that cannot run anymore, according to policy,
+// and launches those whose dependencies completed.
+func launchReady(ctx context.Context, cmd *cobra.Command, policy string, jobs []*workflowJob) {
+	for _, job := range jobs {
+		if job.Status != stepPending {
+			continue
+		}
+
+		skip := false
+		for _, other := range jobs {
+			skip = skip || (policy == onFailureHalt && other.failed())
+		}
+		ready := true
+		for _, dep := range job.deps {
+			skip = skip || dep.failed()
+			ready = ready && dep.Status == jobCompleted
+		}
+		if skip {
+			job.Status = stepSkipped
+			continue
+		}
+		if !ready || ctx.Err() != nil {
+			continue
+		}
+
+		result := launchOne(cmd, job.spec)
+		if result.err != nil {
+			job.Status, job.Error, job.err = stepNotLaunched, result.Error, result.err
+			continue
+		}
+		job.Id, job.Status = result.Id, "registered"
+	}
+}
+
+// workflowResult returns nil if every job of a workflow completed, or the
+// error of the first that did not.
+func workflowResult(name string, jobs []*workflowJob) error {
+	completed := 0
+	var first error
+	for _, job := range jobs {
+		switch {
+		case job.Status == jobCompleted:
+			completed++
+		case first != nil:
+		case job.err != nil:
+			first = job.err
+		case finished(job.Status):
+			first = &jobError{id: job.Id, status: job.Status}
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	return fmt.Errorf("workflow %s did not complete, %d of %d jobs completed, the first failure: %w", name, completed, len(jobs), first)
+}
+
+// workflowProgress shows the status of the jobs of a workflow, a line per
+// job.
+func workflowProgress(w io.Writer, jobs []*workflowJob) *progress {
+	width := 0
+	for _, job := range jobs {
+		if len(job.Name) > width {
+			width = len(job.Name)
+		}
+	}
+	return newProgress(w, func(p *progress) []string {
+		var lines []string
+		for _, job := range jobs {
+			lines = append(lines, workflowLine(p, width, job))
+		}
+		return lines
+	})
+}
+
+// workflowLine returns the line of job: a mark, its name padded to width, its
+// status and what it is waiting for or where it runs.
+func workflowLine(p *progress, width int, job *workflowJob) string {
+	mark := ' '
+	detail := ""
+	switch {
+	case job.Status == jobCompleted:
+		mark = '+'
+	case job.Status == stepSkipped:
+		mark = '-'
+	case job.failed():
+		mark = 'x'
+		detail = job.Error
+	case job.Status == stepPending:
+		if len(job.DependsOn) > 0 {
+			detail = "after " + strings.Join(job.DependsOn, ", ")
+		}
+	default:
+		mark = p.mark()
+		if job.Node != "" {
+			detail = "on " + job.Node
+		}
+		if p.tty {
+			detail += fmt.Sprintf(" (%s)", p.elapsed())
+		}
+	}
+
+	line := fmt.Sprintf("%c %-*s %-12s", mark, width, job.Name, job.Status)
+	if job.Id != "" {
+		line += " " + job.Id
+	}
+	return strings.TrimRight(line+" "+strings.TrimSpace(detail), " ")
+}
+
+func init() {
+	rootCmd.AddCommand(workflowCmd)
+	workflowCmd.AddCommand(workflowRunCmd)
+
+	// Launching uploads the scripts
+	setTimeout(workflowRunCmd, 2*time.Minute)
+
+	workflowRunCmd.Flags().StringVar(&workflowOnFailure, "on-failure", "", "what to do when a job fails, halt or continue (default on_failure of the file, or halt)")
+	workflowRunCmd.Flags().BoolVar(&workflowDryRun, "dry-run", false, "check the workflow and print its stages without launching anything")
+	addWaitFlags(workflowRunCmd)
+}
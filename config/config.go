@@ -0,0 +1,119 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+
+// Package config reads and writes the cloud cli configuration file, which
+// holds named contexts, one per cloud manager.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	CurrentContext string              `json:"current-context,omitempty" yaml:"current-context,omitempty"`
+	Contexts       map[string]*Context `json:"contexts,omitempty" yaml:"contexts,omitempty"`
+}
+
+// Context holds everything needed to talk to one cloud manager.
+type Context struct {
+	// Manager is the base url of the manager, e.g. https://10.140.17.117
+	Manager string `json:"manager,omitempty" yaml:"manager,omitempty"`
+	// CACert is a PEM bundle trusted to sign the manager's certificate
+	CACert string `json:"ca-cert,omitempty" yaml:"ca-cert,omitempty"`
+	// ClientCert and ClientKey are used for mutual TLS
+	ClientCert string `json:"client-cert,omitempty" yaml:"client-cert,omitempty"`
+	ClientKey  string `json:"client-key,omitempty" yaml:"client-key,omitempty"`
+	// InsecureSkipTLSVerify disables the verification of the manager's
+	// certificate
+	InsecureSkipTLSVerify bool `json:"insecure-skip-tls-verify,omitempty" yaml:"insecure-skip-tls-verify,omitempty"`
+	// Token is the bearer token obtained with cloud login
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	// Output is the default output format of the commands
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// DefaultPath returns the path of the configuration file in the user config
+// directory, e.g. ~/.config/cloud/config.yaml on linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloud", "config.yaml"), nil
+}
+
+// Load reads the configuration file at path. A missing file is an empty
+// configuration.
+func Load(path string) (*Config, error) {
+	config := &Config{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Save writes the configuration file at path, creating its directory if
+// needed. The file is only readable by the current user since contexts may
+// hold credentials.
+func (c *Config) Save(path string) error {
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	err := encoder.Encode(c)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data.Bytes(), 0600)
+}
+
+// Context returns the context with the given name, or the current context if
+// name is empty. It returns nil if there is no such context.
+func (c *Config) Context(name string) *Context {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	return c.Contexts[name]
+}
+
+// SetContext adds or replaces the context with the given name.
+func (c *Config) SetContext(name string, context *Context) {
+	if c.Contexts == nil {
+		c.Contexts = map[string]*Context{}
+	}
+	c.Contexts[name] = context
+}
+
+// Names returns the names of every context, sorted.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
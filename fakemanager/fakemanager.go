@@ -0,0 +1,905 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+
+// Package fakemanager is an in-memory stand-in for the cloud manager. It
+// serves the same endpoints as the real manager so that the cli and the
+// client package can be exercised without any infrastructure, e.g. with
+// httptest.NewServer(fakemanager.New()). With Open, the state is kept in a
+// file, and with JobDuration, launched jobs run and end on their own, which is
+// what cloud mock-manager serves.
+package fakemanager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"awsonbudget/cli/client"
+)
+
+// Statuses used by the fake manager for nodes and jobs.
+const (
+	NodeIdle    = "idle"
+	NodeRunning = "running"
+	NodeOnline  = "online"
+	NodePaused  = "paused"
+
+	JobRegistered = "registered"
+	JobRunning    = "running"
+	JobCompleted  = "completed"
+	JobFailed     = "failed"
+	JobAborted    = "aborted"
+)
+
+// firstPort is the port given to the first server node launched.
+const firstPort = 8000
+
+// Manager is a fake cloud manager. It is safe for concurrent use.
+type Manager struct {
+	// Token, if set, must be sent as a bearer token with every request but
+	// login
+	Token string
+	// Users are the usernames and passwords accepted by login
+	Users map[string]string
+	// JobDuration is how long a simulated job runs once a job node is free
+	// to run it. Zero disables the simulation: jobs stay registered until
+	// SetJobStatus is called.
+	JobDuration time.Duration
+
+	mu    sync.Mutex
+	mux   *http.ServeMux
+	path  string
+	state state
+}
+
+// state is everything the manager knows, as saved in its state file.
+type state struct {
+	LastId   int     `json:"last_id"`
+	LastPort int     `json:"last_port"`
+	Pods     []*pod  `json:"pods"`
+	Nodes    []*node `json:"nodes"`
+	Jobs     []*job  `json:"jobs"`
+}
+
+type pod struct {
+	client.Pod
+	LowerThreshold float64 `json:"lower_threshold"`
+	UpperThreshold float64 `json:"upper_threshold"`
+	MinNode        int     `json:"min_node"`
+	MaxNode        int     `json:"max_node"`
+}
+
+type node struct {
+	client.Node
+	Port int    `json:"port"`
+	Log  string `json:"log"`
+}
+
+type job struct {
+	client.Job
+	Script    string                 `json:"script"`
+	Filename  string                 `json:"filename"`
+	Log       string                 `json:"log"`
+	Started   time.Time              `json:"started"`
+	Submitted time.Time              `json:"submitted"`
+	Ended     time.Time              `json:"ended"`
+	ExitCode  *int                   `json:"exit_code,omitempty"`
+	History   []client.JobTransition `json:"history,omitempty"`
+	// Printed is the number of script lines already in the log
+	Printed int `json:"printed"`
+	// Artifacts are the files produced by the job, by name
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+	// Bundle lists the files uploaded with the script, if any
+	Bundle     []string `json:"bundle,omitempty"`
+	Entrypoint string   `json:"entrypoint,omitempty"`
+}
+
+// Open returns a fake manager whose state is loaded from the file at path, if
+// it exists, and saved back to it after every request.
+func Open(path string) (*Manager, error) {
+	m := New()
+	m.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &m.state)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// save writes the state to the state file, through a temporary file so that
+// a crash never leaves a truncated state behind.
+func (m *Manager) save() error {
+	data, err := json.MarshalIndent(&m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+// New returns a fake manager with no pods, as before cloud init.
+func New() *Manager {
+	m := &Manager{}
+
+	m.mux = http.NewServeMux()
+	m.mux.HandleFunc("/cloud/", m.handleInit)
+	m.mux.HandleFunc("/cloud/login/", m.handleLogin)
+	m.mux.HandleFunc("/cloud/pod/", m.handlePod)
+	m.mux.HandleFunc("/cloud/node/", m.handleNode)
+	m.mux.HandleFunc("/cloud/node/log/", m.handleNodeLog)
+	m.mux.HandleFunc("/cloud/job/", m.handleJob)
+	m.mux.HandleFunc("/cloud/job/log/", m.handleJobLog)
+	m.mux.HandleFunc("/cloud/job/describe/", m.handleJobDescribe)
+	m.mux.HandleFunc("/cloud/job/output/", m.handleJobOutput)
+	m.mux.HandleFunc("/cloud/job/output/file/", m.handleJobOutputFile)
+	m.mux.HandleFunc("/cloud/server/", m.handleServer)
+	m.mux.HandleFunc("/cloud/elasticity/", m.handleElasticity)
+	return m
+}
+
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.Token != "" && r.URL.Path != "/cloud/login/" &&
+		r.Header.Get("Authorization") != "Bearer "+m.Token {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(client.Response{Msg: "unauthorized"})
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance(time.Now())
+	m.mux.ServeHTTP(w, r)
+
+	if m.path != "" {
+		err := m.save()
+		if err != nil {
+			log.Printf("could not save the state in %s: %v", m.path, err)
+		}
+	}
+}
+
+// reply sends a successful response holding data, if any.
+func reply(w http.ResponseWriter, msg string, data any) {
+	response := map[string]any{"status": true, "msg": msg}
+	if data != nil {
+		response["data"] = data
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fail sends a status=false response, the way the manager rejects requests.
+func fail(w http.ResponseWriter, format string, a ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.Response{Msg: fmt.Sprintf(format, a...)})
+}
+
+// failStatus sends a manager response with an error status, for the endpoints
+// that do not answer with JSON when they succeed.
+func failStatus(w http.ResponseWriter, status int, format string, a ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(client.Response{Msg: fmt.Sprintf(format, a...)})
+}
+
+// notAllowed answers a method the endpoint does not implement.
+func notAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, r.Method+" not allowed on "+r.URL.Path, http.StatusMethodNotAllowed)
+}
+
+// newId returns a new unique id with the given prefix, e.g. pod-1.
+func (m *Manager) newId(prefix string) string {
+	m.state.LastId++
+	return prefix + "-" + strconv.Itoa(m.state.LastId)
+}
+
+func (m *Manager) findPod(id string) *pod {
+	for _, p := range m.state.Pods {
+		if p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (m *Manager) findNode(id string) *node {
+	for _, n := range m.state.Nodes {
+		if n.Id == id {
+			return n
+		}
+	}
+	return nil
+}
+
+func (m *Manager) findJob(id string) *job {
+	for _, j := range m.state.Jobs {
+		if j.Id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// nodesOf returns the nodes of the pod with the given id.
+func (m *Manager) nodesOf(podId string) []*node {
+	var nodes []*node
+	for _, n := range m.state.Nodes {
+		if n.Pod.Id == podId {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (m *Manager) handleInit(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cloud/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		notAllowed(w, r)
+		return
+	}
+
+	for _, p := range m.state.Pods {
+		if p.Name == "default" {
+			reply(w, "the cloud is already initialized", nil)
+			return
+		}
+	}
+	m.state.Pods = append(m.state.Pods, &pod{Pod: client.Pod{Name: "default", Id: m.newId("pod"), Type: "job"}})
+	reply(w, "cloud initialized with the default pod", nil)
+}
+
+func (m *Manager) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		notAllowed(w, r)
+		return
+	}
+
+	username, password := r.PostFormValue("username"), r.PostFormValue("password")
+	expected, ok := m.Users[username]
+	if !ok || expected != password || m.Token == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(client.Response{Msg: "invalid username or password"})
+		return
+	}
+	reply(w, "logged in", map[string]string{"token": m.Token})
+}
+
+func (m *Manager) handlePod(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cloud/pod/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		pods := []client.Pod{}
+		for _, p := range m.state.Pods {
+			p.Nodes = len(m.nodesOf(p.Id))
+			pods = append(pods, p.Pod)
+		}
+		reply(w, "pods listed", pods)
+
+	case http.MethodPost:
+		podType, name := query.Get("pod_type"), query.Get("pod_name")
+		if podType != "job" && podType != "server" {
+			fail(w, "pod type must be job or server, got %q", podType)
+			return
+		}
+		if name == "" {
+			fail(w, "a pod name is required")
+			return
+		}
+		for _, p := range m.state.Pods {
+			if p.Name == name {
+				fail(w, "a pod named %s already exists", name)
+				return
+			}
+		}
+		p := &pod{Pod: client.Pod{Name: name, Id: m.newId("pod"), Type: podType}}
+		m.state.Pods = append(m.state.Pods, p)
+		reply(w, "pod "+p.Id+" registered", nil)
+
+	case http.MethodDelete:
+		p := m.findPod(query.Get("pod_id"))
+		if p == nil {
+			fail(w, "pod %s not found", query.Get("pod_id"))
+			return
+		}
+		if len(m.nodesOf(p.Id)) > 0 {
+			fail(w, "pod %s still has nodes", p.Id)
+			return
+		}
+		for i := range m.state.Pods {
+			if m.state.Pods[i] == p {
+				m.state.Pods = append(m.state.Pods[:i], m.state.Pods[i+1:]...)
+				break
+			}
+		}
+		reply(w, "pod "+p.Id+" removed", nil)
+
+	default:
+		notAllowed(w, r)
+	}
+}
+
+func (m *Manager) handleNode(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cloud/node/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		podId := query.Get("pod_id")
+		if podId != "" && m.findPod(podId) == nil {
+			fail(w, "pod %s not found", podId)
+			return
+		}
+		nodes := []client.Node{}
+		for _, n := range m.state.Nodes {
+			if podId == "" || n.Pod.Id == podId {
+				nodes = append(nodes, n.Node)
+			}
+		}
+		reply(w, "nodes listed", nodes)
+
+	case http.MethodPost:
+		nodeType, name := query.Get("node_type"), query.Get("node_name")
+		p := m.findPod(query.Get("pod_id"))
+		if p == nil {
+			fail(w, "pod %s not found", query.Get("pod_id"))
+			return
+		}
+		if nodeType != p.Type {
+			fail(w, "pod %s only accepts %s nodes", p.Id, p.Type)
+			return
+		}
+		if name == "" {
+			fail(w, "a node name is required")
+			return
+		}
+		n := &node{Node: client.Node{
+			Name:   name,
+			Id:     m.newId("node"),
+			Type:   nodeType,
+			Status: NodeIdle,
+			Pod:    client.NodePod{Name: p.Name, Id: p.Id},
+		}}
+		n.Log = "node " + n.Id + " registered in pod " + p.Id + "\n"
+		m.state.Nodes = append(m.state.Nodes, n)
+		reply(w, "node "+n.Id+" registered", nil)
+
+	case http.MethodDelete:
+		n := m.findNode(query.Get("node_id"))
+		if n == nil {
+			fail(w, "node %s not found", query.Get("node_id"))
+			return
+		}
+		if n.Status == NodeRunning {
+			fail(w, "node %s is running a job", n.Id)
+			return
+		}
+		for i := range m.state.Nodes {
+			if m.state.Nodes[i] == n {
+				m.state.Nodes = append(m.state.Nodes[:i], m.state.Nodes[i+1:]...)
+				break
+			}
+		}
+		reply(w, "node "+n.Id+" removed", nil)
+
+	default:
+		notAllowed(w, r)
+	}
+}
+
+func (m *Manager) handleNodeLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+
+	n := m.findNode(r.URL.Query().Get("node_id"))
+	if n == nil {
+		fail(w, "node %s not found", r.URL.Query().Get("node_id"))
+		return
+	}
+	reply(w, "node log", n.Log)
+}
+
+func (m *Manager) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cloud/job/" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		nodeId := query.Get("node_id")
+		jobs := []client.Job{}
+		for _, j := range m.state.Jobs {
+			if nodeId == "" || j.Node == nodeId {
+				jobs = append(jobs, j.Job)
+			}
+		}
+		reply(w, "jobs listed", jobs)
+
+	case http.MethodPost:
+		name := query.Get("job_name")
+		if name == "" {
+			fail(w, "a job name is required")
+			return
+		}
+		// The script is uploaded on its own, or as the entrypoint of a bundle
+		var script []byte
+		var filename string
+		var bundle []string
+		entrypoint := query.Get("entrypoint")
+		bundleFile, _, err := r.FormFile("job_bundle")
+		if err == nil {
+			defer bundleFile.Close()
+			bundle, script, err = readBundle(bundleFile, entrypoint)
+			if err != nil {
+				fail(w, "could not read the job bundle: %v", err)
+				return
+			}
+			if script == nil {
+				fail(w, "the entrypoint %q is not in the job bundle", entrypoint)
+				return
+			}
+			filename = path.Base(entrypoint)
+		} else if err != http.ErrMissingFile {
+			fail(w, "could not read the job bundle: %v", err)
+			return
+		} else {
+			file, header, err := r.FormFile("job_script")
+			if err != nil {
+				fail(w, "a job script is required: %v", err)
+				return
+			}
+			defer file.Close()
+			script, err = io.ReadAll(file)
+			if err != nil {
+				fail(w, "could not read the job script: %v", err)
+				return
+			}
+			filename = header.Filename
+		}
+
+		var spec *client.JobSpec
+		if field := r.FormValue("job_spec"); field != "" {
+			spec = &client.JobSpec{}
+			err = json.Unmarshal([]byte(field), spec)
+			if err != nil {
+				fail(w, "could not parse the job spec: %v", err)
+				return
+			}
+		}
+
+		j := &job{
+			Job:        client.Job{Name: name, Id: m.newId("job"), Spec: spec},
+			Script:     string(script),
+			Filename:   filename,
+			Submitted:  time.Now(),
+			Bundle:     bundle,
+			Entrypoint: entrypoint,
+		}
+		setStatus(j, JobRegistered, j.Submitted)
+		j.Log = "job " + j.Id + " registered\n"
+		m.state.Jobs = append(m.state.Jobs, j)
+		reply(w, "job "+j.Id+" launched", map[string]string{"job_id": j.Id})
+
+	case http.MethodDelete:
+		j := m.findJob(query.Get("job_id"))
+		if j == nil {
+			fail(w, "job %s not found", query.Get("job_id"))
+			return
+		}
+		if j.Status != JobRegistered && j.Status != JobRunning {
+			fail(w, "job %s is already %s", j.Id, j.Status)
+			return
+		}
+		m.finishJob(j, JobAborted, time.Now())
+		reply(w, "job "+j.Id+" aborted", nil)
+
+	default:
+		notAllowed(w, r)
+	}
+}
+
+// readBundle returns the names of the files of a gzipped tar archive and the
+// content of entrypoint, nil if it is not one of them.
+func readBundle(r io.Reader, entrypoint string) ([]string, []byte, error) {
+	zipped, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	archive := tar.NewReader(zipped)
+
+	var names []string
+	var script []byte
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return names, script, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, header.Name)
+		if header.Name == entrypoint {
+			script, err = io.ReadAll(archive)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+func (m *Manager) handleJobLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+
+	j := m.findJob(r.URL.Query().Get("job_id"))
+	if j == nil {
+		fail(w, "job %s not found", r.URL.Query().Get("job_id"))
+		return
+	}
+	reply(w, "job log", j.Log)
+}
+
+// setStatus moves j to status at now and records it in its history.
+func setStatus(j *job, status string, now time.Time) {
+	j.Status = status
+	j.History = append(j.History, client.JobTransition{Status: status, Time: now})
+}
+
+func (m *Manager) handleJobDescribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+
+	j := m.findJob(r.URL.Query().Get("job_id"))
+	if j == nil {
+		fail(w, "job %s not found", r.URL.Query().Get("job_id"))
+		return
+	}
+	sum := sha256.Sum256([]byte(j.Script))
+	submitted := j.Submitted
+	details := client.JobDetails{
+		Job:       j.Job,
+		Submitted: &submitted,
+		Started:   timeOrNil(j.Started),
+		Ended:     timeOrNil(j.Ended),
+		ExitCode:  j.ExitCode,
+		Filename:  j.Filename,
+		Sha256:    hex.EncodeToString(sum[:]),
+		History:   j.History,
+	}
+	if n := m.findNode(j.Node); n != nil {
+		details.Pod = n.Pod.Name
+	}
+	reply(w, "job "+j.Id+" described", details)
+}
+
+// timeOrNil returns nil for the zero time, which is left out of responses.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (m *Manager) handleJobOutput(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/cloud/job/output/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+
+	j := m.findJob(r.URL.Query().Get("job_id"))
+	if j == nil {
+		fail(w, "job %s not found", r.URL.Query().Get("job_id"))
+		return
+	}
+	var names []string
+	for name := range j.Artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	artifacts := []client.Artifact{}
+	for _, name := range names {
+		content := j.Artifacts[name]
+		sum := sha256.Sum256([]byte(content))
+		artifacts = append(artifacts, client.Artifact{Name: name, Size: int64(len(content)), Sha256: hex.EncodeToString(sum[:])})
+	}
+	reply(w, "job output listed", artifacts)
+}
+
+func (m *Manager) handleJobOutputFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		notAllowed(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	j := m.findJob(query.Get("job_id"))
+	if j == nil {
+		failStatus(w, http.StatusNotFound, "job %s not found", query.Get("job_id"))
+		return
+	}
+	content, ok := j.Artifacts[query.Get("name")]
+	if !ok {
+		failStatus(w, http.StatusNotFound, "job %s has no file %s", j.Id, query.Get("name"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	io.WriteString(w, content)
+}
+
+// advance moves the simulated jobs forward to now: registered jobs start on
+// the first idle job node, running jobs print their script one line at a time
+// and end once JobDuration has elapsed. A script containing "exit 1" fails.
+func (m *Manager) advance(now time.Time) {
+	if m.JobDuration <= 0 {
+		return
+	}
+
+	for _, j := range m.state.Jobs {
+		switch j.Status {
+		case JobRegistered:
+			n := m.idleJobNode()
+			if n == nil {
+				continue
+			}
+			setStatus(j, JobRunning, now)
+			j.Node, j.Started = n.Id, now
+			j.Log += "job " + j.Id + " running on node " + n.Id + "\n"
+			n.Status = NodeRunning
+			n.Log += "job " + j.Id + " running\n"
+
+		case JobRunning:
+			elapsed := now.Sub(j.Started)
+			lines := strings.Split(strings.TrimRight(j.Script, "\n"), "\n")
+			printed := len(lines)
+			if elapsed < m.JobDuration {
+				printed = int(float64(len(lines)) * float64(elapsed) / float64(m.JobDuration))
+			}
+			for ; j.Printed < printed; j.Printed++ {
+				j.Log += "+ " + lines[j.Printed] + "\n"
+			}
+
+			if elapsed >= m.JobDuration {
+				status := JobCompleted
+				if strings.Contains(j.Script, "exit 1") {
+					status = JobFailed
+				}
+				m.finishJob(j, status, now)
+			}
+		}
+	}
+}
+
+// idleJobNode returns a job node free to run a job, or nil.
+func (m *Manager) idleJobNode() *node {
+	for _, n := range m.state.Nodes {
+		if n.Type == "job" && n.Status == NodeIdle {
+			return n
+		}
+	}
+	return nil
+}
+
+// finishJob moves j to a final status at now and frees its node. A job that
+// ran to its end leaves its log as an artifact and an exit code.
+func (m *Manager) finishJob(j *job, status string, now time.Time) {
+	setStatus(j, status, now)
+	j.Ended = now
+	j.Log += "job " + j.Id + " " + status + "\n"
+	if status != JobAborted {
+		code := 0
+		if status == JobFailed {
+			code = 1
+		}
+		j.ExitCode = &code
+		if j.Artifacts == nil {
+			j.Artifacts = map[string]string{}
+		}
+		j.Artifacts["output.log"] = j.Log
+	}
+	if n := m.findNode(j.Node); n != nil {
+		n.Status = NodeIdle
+		n.Log += "job " + j.Id + " " + status + "\n"
+	}
+}
+
+func (m *Manager) handleServer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		notAllowed(w, r)
+		return
+	}
+
+	p := m.findPod(r.URL.Query().Get("pod_id"))
+	if p == nil {
+		fail(w, "pod %s not found", r.URL.Query().Get("pod_id"))
+		return
+	}
+	if p.Type != "server" {
+		fail(w, "pod %s is not a server pod", p.Id)
+		return
+	}
+
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cloud/server/"), "/")
+	done, ok := map[string]string{"launch": "launched", "pause": "paused", "resume": "resumed"}[action]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	servers := []client.ServerNode{}
+	for _, n := range m.nodesOf(p.Id) {
+		switch action {
+		case "launch":
+			if n.Port == 0 {
+				n.Port = firstPort + m.state.LastPort
+				m.state.LastPort++
+			}
+			n.Status = NodeOnline
+		case "pause":
+			n.Status = NodePaused
+		case "resume":
+			n.Status = NodeOnline
+		}
+		n.Log += "server " + done + "\n"
+		servers = append(servers, client.ServerNode{NodeId: n.Id, Port: n.Port})
+	}
+	reply(w, "servers of pod "+p.Id+" "+done, servers)
+}
+
+func (m *Manager) handleElasticity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		notAllowed(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	p := m.findPod(query.Get("pod_id"))
+	if p == nil {
+		fail(w, "pod %s not found", query.Get("pod_id"))
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/cloud/elasticity/"), "/") {
+	case "lower":
+		value, err := strconv.ParseFloat(query.Get("lower_threshold"), 64)
+		if err != nil {
+			fail(w, "invalid lower threshold")
+			return
+		}
+		p.LowerThreshold = value
+		reply(w, "", nil)
+	case "upper":
+		value, err := strconv.ParseFloat(query.Get("upper_threshold"), 64)
+		if err != nil {
+			fail(w, "invalid upper threshold")
+			return
+		}
+		p.UpperThreshold = value
+		reply(w, "", nil)
+	case "enable":
+		minNode, err1 := strconv.Atoi(query.Get("min_node"))
+		maxNode, err2 := strconv.Atoi(query.Get("max_node"))
+		if err1 != nil || err2 != nil || minNode > maxNode {
+			fail(w, "invalid min_node and max_node")
+			return
+		}
+		p.Elastic, p.MinNode, p.MaxNode = true, minNode, maxNode
+		reply(w, "elasticity enabled for pod "+p.Id, nil)
+	case "disable":
+		p.Elastic = false
+		reply(w, "", nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// SetJobStatus moves the job with the given id to status, as if it had been
+// run by a node.
+func (m *Manager) SetJobStatus(id, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.findJob(id)
+	if j == nil {
+		return
+	}
+	now := time.Now()
+	if status == JobCompleted || status == JobFailed || status == JobAborted {
+		m.finishJob(j, status, now)
+		return
+	}
+	setStatus(j, status, now)
+	if status == JobRunning && j.Started.IsZero() {
+		j.Started = now
+	}
+	j.Log += "job " + j.Id + " " + status + "\n"
+}
+
+// SetArtifact adds a file produced by the job with the given id.
+func (m *Manager) SetArtifact(id, name, content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j := m.findJob(id); j != nil {
+		if j.Artifacts == nil {
+			j.Artifacts = map[string]string{}
+		}
+		j.Artifacts[name] = content
+	}
+}
+
+// Bundle returns the names of the files uploaded with the script of the job
+// with the given id, and the entrypoint among them.
+func (m *Manager) Bundle(id string) ([]string, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j := m.findJob(id); j != nil {
+		return j.Bundle, j.Entrypoint
+	}
+	return nil, ""
+}
+
+// Script returns the script uploaded for the job with the given id.
+func (m *Manager) Script(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j := m.findJob(id); j != nil {
+		return j.Script
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+
+// Package history records the jobs launched by the cloud cli, with a copy of
+// their script, so that they can be browsed and launched again later.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"awsonbudget/cli/client"
+)
+
+// Submission is a job launched by the cli.
+type Submission struct {
+	Time    time.Time `json:"time" yaml:"time"`
+	Manager string    `json:"manager" yaml:"manager"`
+	Id      string    `json:"job_id" yaml:"job_id"`
+	Name    string    `json:"name" yaml:"name"`
+	// Script is the absolute path of the script, or of the directory of a
+	// bundle, as given to job launch, or of the template of a sweep
+	Script string `json:"script" yaml:"script"`
+	// Filename is the name the script was uploaded under
+	Filename string `json:"filename" yaml:"filename"`
+	// Sha256 is the hex encoded SHA-256 of the script, under which a copy of
+	// it is kept
+	Sha256 string          `json:"sha256" yaml:"sha256"`
+	Spec   *client.JobSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+	// Files and Entrypoint are those of a bundle, if the job had one
+	Files      []string `json:"files,omitempty" yaml:"files,omitempty"`
+	Entrypoint string   `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	// Bundle is the hex encoded SHA-256 of every file of the bundle, by name
+	// in the bundle
+	Bundle map[string]string `json:"bundle,omitempty" yaml:"bundle,omitempty"`
+	// RerunOf is the job this one was launched again from, if any
+	RerunOf string `json:"rerun_of,omitempty" yaml:"rerun_of,omitempty"`
+}
+
+// Store is a directory holding the submissions, a JSON line each in
+// submissions.jsonl, and the scripts they uploaded in scripts/. Several
+// stores, even of several processes, can add to the same directory at once.
+type Store struct {
+	dir string
+}
+
+// Open returns the store in dir, which is created on the first submission.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) file() string {
+	return filepath.Join(s.dir, "submissions.jsonl")
+}
+
+func (s *Store) scriptFile(sum string) string {
+	return filepath.Join(s.dir, "scripts", sum)
+}
+
+// Sum returns the hex encoded SHA-256 of script.
+func Sum(script []byte) string {
+	sum := sha256.Sum256(script)
+	return hex.EncodeToString(sum[:])
+}
+
+// Keep copies the script read from r into the store and returns its hex
+// encoded SHA-256, under which it is kept. The script is streamed rather than
+// read in memory.
+func (s *Store) Keep(r io.Reader) (string, error) {
+	dir := filepath.Join(s.dir, "scripts")
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	// Scripts are named after their content, a script already kept is the
+	// same script
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.scriptFile(sum))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return sum, nil
+}
+
+// Add records sub, whose script was kept with Keep under sub.Sha256.
+func (s *Store) Add(sub *Submission) error {
+	line, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// A single write in append mode, so that concurrent submissions do not
+	// interleave
+	f, err := os.OpenFile(s.file(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// List returns every submission, oldest first. Lines that cannot be parsed,
+// e.g. cut short by a crash, are skipped.
+func (s *Store) List() ([]Submission, error) {
+	data, err := os.ReadFile(s.file())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []Submission
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var sub Submission
+		if json.Unmarshal(scanner.Bytes(), &sub) == nil && sub.Id != "" {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, scanner.Err()
+}
+
+// Find returns the latest submission of the job with id, or nil if it was
+// not launched from here.
+func (s *Store) Find(id string) (*Submission, error) {
+	subs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(subs) - 1; i >= 0; i-- {
+		if subs[i].Id == id {
+			return &subs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// OpenScript opens the script kept under sum, once it is checked to be the
+// same as when it was kept.
+func (s *Store) OpenScript(sum string) (*os.File, error) {
+	f, err := os.Open(s.scriptFile(sum))
+	if err != nil {
+		return nil, fmt.Errorf("the script %.12s is no longer kept: %w", sum, err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != sum {
+		err = fmt.Errorf("the copy of the script %.12s was modified", sum)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
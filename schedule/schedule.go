@@ -0,0 +1,229 @@
+/*
+Copyright © 2023 Joey Yu <xiaowei.yu@mail.mcgill.ca>
+*/
+
+// Package schedule keeps the jobs scheduled by the cloud cli, to be launched
+// at a given time or on a cron schedule by the scheduler.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"awsonbudget/cli/client"
+)
+
+// maxRuns is how many runs of an entry are kept.
+const maxRuns = 20
+
+// Retries of a job launched once whose launch failed: at most maxAttempts
+// launches, retryDelay after the first failure and twice as long after every
+// other.
+const (
+	maxAttempts = 5
+	retryDelay  = time.Minute
+)
+
+// Entry is a scheduled job.
+type Entry struct {
+	Id   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+	// Script is the absolute path of the script when it was scheduled
+	Script   string `json:"script" yaml:"script"`
+	Filename string `json:"filename" yaml:"filename"`
+	// Sha256 is the hex encoded SHA-256 of the script, under which a copy of
+	// it is kept in the history
+	Sha256  string          `json:"sha256" yaml:"sha256"`
+	Spec    *client.JobSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+	Manager string          `json:"manager" yaml:"manager"`
+	// At is set for a job launched once, Cron for a recurring job
+	At   *time.Time `json:"at,omitempty" yaml:"at,omitempty"`
+	Cron string     `json:"cron,omitempty" yaml:"cron,omitempty"`
+	// Next is when the job is launched next, nil once there is no next time
+	Next    *time.Time `json:"next,omitempty" yaml:"next,omitempty"`
+	Created time.Time  `json:"created" yaml:"created"`
+	// Runs are the latest launches of the job, the oldest first
+	Runs []Run `json:"runs,omitempty" yaml:"runs,omitempty"`
+}
+
+// Run is a launch of a scheduled job.
+type Run struct {
+	Time  time.Time `json:"time" yaml:"time"`
+	Id    string    `json:"job_id,omitempty" yaml:"job_id,omitempty"`
+	Error string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Due reports whether e is to be launched at now.
+func (e *Entry) Due(now time.Time) bool {
+	return e.Next != nil && !e.Next.After(now)
+}
+
+// Advance moves e to its next time after now: the next match of its cron
+// expression, or none for a job launched once.
+func (e *Entry) Advance(now time.Time) error {
+	e.Next = nil
+	if e.Cron == "" {
+		return nil
+	}
+	c, err := ParseCron(e.Cron)
+	if err != nil {
+		return err
+	}
+	if next := c.Next(now); !next.IsZero() {
+		e.Next = &next
+	}
+	return nil
+}
+
+// Retry makes e, a job launched once, due again after its launch failed at
+// now and was recorded with AddRun. It reports false once e was tried
+// maxAttempts times, e is then over.
+func (e *Entry) Retry(now time.Time) bool {
+	e.Next = nil
+	if e.At == nil || len(e.Runs) == 0 || len(e.Runs) >= maxAttempts {
+		return false
+	}
+	next := now.Add(retryDelay << (len(e.Runs) - 1))
+	e.Next = &next
+	return true
+}
+
+// AddRun records a launch of e, dropping the oldest beyond maxRuns.
+func (e *Entry) AddRun(run Run) {
+	e.Runs = append(e.Runs, run)
+	if len(e.Runs) > maxRuns {
+		e.Runs = e.Runs[len(e.Runs)-maxRuns:]
+	}
+}
+
+// File is the content of the schedule file.
+type File struct {
+	LastId  int      `json:"last_id"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Add adds e with a new id.
+func (f *File) Add(e *Entry) {
+	f.LastId++
+	e.Id = "sched-" + strconv.Itoa(f.LastId)
+	f.Entries = append(f.Entries, e)
+}
+
+// Find returns the entry with id, or nil.
+func (f *File) Find(id string) *Entry {
+	for _, e := range f.Entries {
+		if e.Id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// Remove removes the entry with id and reports whether there was one.
+func (f *File) Remove(id string) bool {
+	for i, e := range f.Entries {
+		if e.Id == id {
+			f.Entries = append(f.Entries[:i], f.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Store is a directory holding the schedule file, schedules.json. Changes are
+// made under a lock file so that the scheduler and other commands can share
+// it.
+type Store struct {
+	dir string
+}
+
+// Open returns the store in dir, which is created on the first change.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) file() string {
+	return filepath.Join(s.dir, "schedules.json")
+}
+
+// Load reads the schedule file. A missing file has no entries.
+func (s *Store) Load() (*File, error) {
+	f := &File{}
+	data, err := os.ReadFile(s.file())
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", s.file(), err)
+	}
+	return f, nil
+}
+
+// Update applies change to the schedule file under the lock and saves it,
+// unless change fails.
+func (s *Store) Update(change func(f *File) error) error {
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := s.Load()
+	if err != nil {
+		return err
+	}
+	err = change(f)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.file() + ".tmp"
+	err = os.WriteFile(tmp, append(data, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file())
+}
+
+// lock creates the lock file, waiting for another command to remove it. A
+// lock file left by a command that crashed is removed after a minute.
+func (s *Store) lock() (func(), error) {
+	path := filepath.Join(s.dir, "schedules.lock")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another cloud command", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}